@@ -29,9 +29,10 @@ import "io"
 
 type Ac struct {
 	val   byte
-	trans *trans // the goto function
-	fail  *Ac    // the fail function
-	out   out    // the output function
+	trans trans // the goto function
+	fail  *Ac   // the fail function
+	dict  *Ac   // the dictionary suffix link: nearest node along the fail chain that has outputs
+	out   out   // the output function (only the sequences that end at this node)
 }
 
 type trans struct {
@@ -41,10 +42,9 @@ type trans struct {
 
 type out [][2]int
 
-func (t *trans) put(b byte, ac *Ac) {
-	t.keys = append(t.keys, b)
-	t.gotos[b] = ac
-}
+// leaf is the goto array shared by all nodes without children. It is never written to:
+// a node is given its own array from the arena when its first child is added.
+var leaf [256]*Ac
 
 func (t *trans) get(b byte) (*Ac, bool) {
 	node := t.gotos[b]
@@ -54,98 +54,40 @@ func (t *trans) get(b byte) (*Ac, bool) {
 	return node, true
 }
 
-func newTrans() *trans { return &trans{keys: make([]byte, 0, 50), gotos: new([256]*Ac)} }
-
-func (o out) contains(i int) bool {
-	for _, v := range o {
-		if v[0] == i {
-			return true
-		}
-	}
-	return false
-}
-
-func newNode() *Ac { return &Ac{trans: newTrans(), out: make(out, 0, 10)} }
-
 // New creates an Aho-Corasick tree from a slice of byte slices
 func New(seqs [][]byte) *Ac {
-	root := newNode()
-	root.addGotos(seqs, false)
-	root.addFails()
-	return root
+	return NewWithOptions(seqs, Options{})
 }
 
-// New creates an Aho-Corasick tree that only has gotos, the fail functions are all set to root.
-// Creates a smaller tree if you are only wanting to use the IndexFixed() function.
-func NewFixed(seqs [][]byte) *Ac {
-	root := newNode()
-	root.addGotos(seqs, true)
-	root.fail = root
-	return root
+// NewWithOptions creates an Aho-Corasick tree from a slice of byte slices, using the given Options.
+// Use it to build very large trees in parallel or to monitor the progress of a build.
+func NewWithOptions(seqs [][]byte, opts Options) *Ac {
+	b := newBuilder(false, opts, len(seqs))
+	for _, seq := range seqs {
+		b.add(seq)
+	}
+	return b.finish()
 }
 
-func (root *Ac) addGotos(seqs [][]byte, fixed bool) {
-	// iterate through byte sequences adding goto links to the link matrix
-	for id, seq := range seqs {
-		curr := root
-		for _, seqByte := range seq {
-			if trans, ok := curr.trans.get(seqByte); ok {
-				curr = trans
-			} else {
-				node := newNode()
-				node.val = seqByte
-				if fixed {
-					node.fail = root
-				}
-				curr.trans.put(seqByte, node)
-				curr = node
-			}
-		}
-		curr.out = append(curr.out, [2]int{id, len(seq)})
+// NewFromIterator creates an Aho-Corasick tree from byte slices returned by next, which should return false once there are no more.
+// Each slice is inserted as soon as it is returned, so the dictionary needn't be held in memory while the tree is built.
+// The slices aren't retained and may be reused by next.
+func NewFromIterator(next func() ([]byte, bool)) *Ac {
+	b := newBuilder(false, Options{}, -1)
+	for seq, ok := next(); ok; seq, ok = next() {
+		b.add(seq)
 	}
+	return b.finish()
 }
 
-func (root *Ac) addFails() {
-	// root and its children fail to root
-	root.fail = root
-	for _, k := range root.trans.keys {
-		root.trans.gotos[k].fail = root
-	}
-	// traverse tree in breadth first search adding fails
-	queue := make([]*Ac, 0, 50)
-	queue = append(queue, root)
-	for len(queue) > 0 {
-		pop := queue[0]
-		for _, key := range pop.trans.keys {
-			node := pop.trans.gotos[key]
-			queue = append(queue, node)
-			// starting from the node's parent, follow the fails back towards root,
-			// and stop at the first fail that has a goto to the node's value
-			fail := pop.fail
-			_, ok := fail.trans.get(node.val)
-			for fail != root && !ok {
-				fail = fail.fail
-				_, ok = fail.trans.get(node.val)
-			}
-			fnode, ok := fail.trans.get(node.val)
-			if ok && fnode != node {
-				node.fail = fnode
-			} else {
-				node.fail = root
-			}
-			// another traverse back to root following the fails. This time add any unique out functions to the node
-			fail = node.fail
-			for fail != root {
-				for _, id := range fail.out {
-					if !node.out.contains(id[0]) {
-						node.out = append(node.out, id)
-					}
-				}
-				fail = fail.fail
-			}
-		}
-		queue = queue[1:]
+// New creates an Aho-Corasick tree that only has gotos, the fail functions are all set to root.
+// Creates a smaller tree if you are only wanting to use the IndexFixed() function.
+func NewFixed(seqs [][]byte) *Ac {
+	b := newBuilder(true, Options{}, len(seqs))
+	for _, seq := range seqs {
+		b.add(seq)
 	}
+	return b.finish()
 }
 
 // Index returns a channel of results, these contain the indexes (in the list of sequences that made the tree)
@@ -182,6 +124,42 @@ func (ac *Ac) IndexFixedQ(input io.ByteReader, quit chan struct{}) chan int {
 	return output
 }
 
+// LongestPrefix returns the index and length of the longest sequence that is a prefix of b.
+// If several identical sequences match, the first of them is returned. Fail links are not followed,
+// so it can be used with trees made by either New or NewFixed.
+func (ac *Ac) LongestPrefix(b []byte) (index, length int, ok bool) {
+	curr := ac
+	for _, c := range b {
+		trans, found := curr.trans.get(c)
+		if !found {
+			break
+		}
+		curr = trans
+		if len(curr.out) > 0 {
+			index, length, ok = curr.out[0][0], curr.out[0][1], true
+		}
+	}
+	return
+}
+
+// AllPrefixes returns the indexes of all the sequences that are prefixes of b, shortest first.
+// It is a synchronous equivalent of IndexFixed.
+func (ac *Ac) AllPrefixes(b []byte) []int {
+	var ret []int
+	curr := ac
+	for _, c := range b {
+		trans, ok := curr.trans.get(c)
+		if !ok {
+			break
+		}
+		curr = trans
+		for _, id := range curr.out {
+			ret = append(ret, id[0])
+		}
+	}
+	return ret
+}
+
 // Result contains the index (in the list of sequences that made the tree) and offset of matches.
 type Result struct {
 	Index  int
@@ -209,6 +187,11 @@ func (ac *Ac) match(input io.ByteReader, results chan Result) {
 		for _, id := range curr.out {
 			results <- Result{Index: id[0], Offset: offset - id[1]}
 		}
+		for dict := curr.dict; dict != nil; dict = dict.dict {
+			for _, id := range dict.out {
+				results <- Result{Index: id[0], Offset: offset - id[1]}
+			}
+		}
 	}
 	close(results)
 }
@@ -244,6 +227,11 @@ func (ac *Ac) matchQ(input io.ByteReader, results chan Result, quit chan struct{
 		for _, id := range curr.out {
 			results <- Result{Index: id[0], Offset: offset - id[1]}
 		}
+		for dict := curr.dict; dict != nil; dict = dict.dict {
+			for _, id := range dict.out {
+				results <- Result{Index: id[0], Offset: offset - id[1]}
+			}
+		}
 	}
 	close(results)
 }
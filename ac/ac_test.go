@@ -2,6 +2,10 @@ package ac
 
 import (
 	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -91,11 +95,31 @@ func testerFixed(t *testing.T, ac *Ac, a []byte, b, d [][]byte) {
 	}
 }
 
+func testerPrefix(t *testing.T, ac *Ac, a []byte, b, d [][]byte) {
+	i := indexes(b, d)
+	results := ac.AllPrefixes(a)
+	if !equalFixed(i, results) {
+		t.Errorf("All Prefixes fail; Expecting: %v, Got: %v", i, results)
+	}
+	idx, l, ok := ac.LongestPrefix(a)
+	if len(i) == 0 {
+		if ok {
+			t.Errorf("Longest Prefix fail; Expecting no result, Got: %d, %d", idx, l)
+		}
+		return
+	}
+	if !ok || idx != i[len(i)-1] || l != len(b[idx]) {
+		t.Errorf("Longest Prefix fail; Expecting: %d, Got: %d, %d, %v", i[len(i)-1], idx, l, ok)
+	}
+}
+
 func test(t *testing.T, a []byte, b, c, d [][]byte) {
 	ac := New(b)
 	tester(t, ac, a, b, c)
+	testerPrefix(t, ac, a, b, d)
 	fc := NewFixed(b)
 	testerFixed(t, fc, a, b, d)
+	testerPrefix(t, fc, a, b, d)
 }
 
 func noResult() [][]byte {
@@ -162,6 +186,119 @@ func TestLong(t *testing.T) {
 		toBytes("in", "into", "to", "acintosh"), noResult())
 }
 
+func TestSuffixChain(t *testing.T) {
+	test(t, []byte("aaaa"), toBytes("a", "aa", "aaa", "b"),
+		toBytes("a", "aa", "a", "aaa", "aa", "a", "aaa", "aa", "a"), toBytes("a", "aa", "aaa"))
+	test(t, []byte("xabcd"), toBytes("abcd", "bc", "c", "d", "cd"),
+		toBytes("bc", "c", "abcd", "cd", "d"), noResult())
+}
+
+func TestWorkers(t *testing.T) {
+	seqs := numbers(20000)
+	input := []byte("1234567890 19999 0042 77777")
+	expect := loop(New(seqs).Index(bytes.NewBuffer(input)))
+	results := loop(NewWithOptions(seqs, Options{Workers: 4}).Index(bytes.NewBuffer(input)))
+	if len(expect) != len(results) {
+		t.Fatalf("Workers fail; Expecting %d results, Got: %d", len(expect), len(results))
+	}
+	for i := range expect {
+		if expect[i] != results[i] {
+			t.Errorf("Workers fail at %d; Expecting: %v, Got: %v", i, expect[i], results[i])
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var reports []Progress
+	NewWithOptions(numbers(ProgressInterval+1), Options{Progress: func(p Progress) { reports = append(reports, p) }})
+	if len(reports) < 3 {
+		t.Fatalf("Progress fail; Got: %v", reports)
+	}
+	if reports[0] != (Progress{Inserting, ProgressInterval, ProgressInterval + 1}) {
+		t.Errorf("Progress fail; Expecting an insertion report, Got: %v", reports[0])
+	}
+	last := reports[len(reports)-1]
+	if last.Phase != Linking || last.Done != last.Total {
+		t.Errorf("Progress fail; Expecting a completed link report, Got: %v", last)
+	}
+}
+
+func TestPrefixRouter(t *testing.T) {
+	routes := toBytes("/", "/api/", "/api/v1/", "/static/")
+	router := NewFixed(routes)
+	for _, c := range []struct {
+		path   string
+		index  int
+		length int
+	}{
+		{"/api/v1/users", 2, 8},
+		{"/api/v2/users", 1, 5},
+		{"/static/app.js", 3, 8},
+		{"/index.html", 0, 1},
+	} {
+		idx, l, ok := router.LongestPrefix([]byte(c.path))
+		if !ok || idx != c.index || l != c.length {
+			t.Errorf("Longest Prefix fail for %s; Expecting: %d, %d, Got: %d, %d, %v", c.path, c.index, c.length, idx, l, ok)
+		}
+	}
+	if _, _, ok := router.LongestPrefix([]byte("api")); ok {
+		t.Error("Longest Prefix fail; Expecting no match for a relative path")
+	}
+}
+
+func TestIterator(t *testing.T) {
+	seqs := toBytes("handle", "hand", "and", "andle")
+	var i int
+	ac := NewFromIterator(func() ([]byte, bool) {
+		if i == len(seqs) {
+			return nil, false
+		}
+		i++
+		return seqs[i-1], true
+	})
+	tester(t, ac, []byte("The pot had a handle"), seqs, toBytes("hand", "and", "handle", "andle"))
+}
+
+func TestWordlist(t *testing.T) {
+	seqs := toBytes("#pot", "h\x61d", "a\tb", "\n")
+	list := "# a comment\r\n\\#pot\n\nh\\x61d\r\na\\tb\n\\n\n"
+	ac, err := NewFromWordlist(strings.NewReader(list), Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester(t, ac, []byte("#pot had a\tb\n"), seqs, toBytes("#pot", "h\x61d", "a\tb", "\n"))
+	ac, err = NewFromWordlist(strings.NewReader("# hex\n23 70 6f 74\n686164\n"), Hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester(t, ac, []byte("#pot had"), toBytes("#pot", "had"), toBytes("#pot", "had"))
+}
+
+func TestWordlistErrors(t *testing.T) {
+	for _, c := range []struct {
+		list   string
+		format Format
+		line   int
+	}{
+		{"ok\n# comment\nbad\\q\n", Text, 3},
+		{"trailing\\", Text, 1},
+		{"\n\nshort\\x4", Text, 3},
+		{"\\xzz", Text, 1},
+		{"00\n0g\n", Hex, 2},
+		{"abc", Hex, 1},
+	} {
+		_, err := NewFromWordlist(strings.NewReader(c.list), c.format)
+		var we *WordlistError
+		if !errors.As(err, &we) {
+			t.Errorf("Wordlist fail; Expecting an error for %q, Got: %v", c.list, err)
+			continue
+		}
+		if we.Line != c.line {
+			t.Errorf("Wordlist fail; Expecting an error on line %d for %q, Got: %v", c.line, c.list, err)
+		}
+	}
+}
+
 // Benchmarks
 func BenchmarkNew(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -169,6 +306,67 @@ func BenchmarkNew(b *testing.B) {
 	}
 }
 
+// a pathological dictionary: every pattern is a suffix of the next, so each node's output chain is as long as its depth
+func suffixTree() [][]byte {
+	ret := make([][]byte, 500)
+	for i := range ret {
+		ret[i] = bytes.Repeat([]byte{'a'}, i+1)
+	}
+	return ret
+}
+
+func BenchmarkNewSuffixes(b *testing.B) {
+	seqs := suffixTree()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = New(seqs)
+	}
+}
+
+func BenchmarkNewHardTree(b *testing.B) {
+	seqs := hardTree()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = New(seqs)
+	}
+}
+
+// numbers returns the decimal representations of 0 to n-1: a large, dense dictionary
+func numbers(n int) [][]byte {
+	ret := make([][]byte, n)
+	for i := range ret {
+		ret[i] = []byte(strconv.Itoa(i))
+	}
+	return ret
+}
+
+// benchmarkBuild reports build time, and the live heap and memory obtained from the OS once the tree is built
+func benchmarkBuild(b *testing.B, n int, opts Options) {
+	seqs := numbers(n)
+	var root *Ac
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root = NewWithOptions(seqs, opts)
+	}
+	b.StopTimer()
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	b.ReportMetric(float64(m.HeapAlloc), "heap-B")
+	b.ReportMetric(float64(m.Sys), "sys-B")
+	runtime.KeepAlive(root)
+}
+
+func BenchmarkBuild10k(b *testing.B)  { benchmarkBuild(b, 10000, Options{}) }
+func BenchmarkBuild100k(b *testing.B) { benchmarkBuild(b, 100000, Options{}) }
+func BenchmarkBuild1M(b *testing.B)   { benchmarkBuild(b, 1000000, Options{}) }
+func BenchmarkBuild1MParallel(b *testing.B) {
+	benchmarkBuild(b, 1000000, Options{Workers: runtime.NumCPU()})
+}
+
 func BenchmarkIndex(b *testing.B) {
 	b.StopTimer()
 	ac := New(toBytes("handle", "handl", "hand", "han", "ha", "a"))
@@ -244,6 +442,16 @@ func BenchmarkMatchingHardTree(b *testing.B) {
 	}
 }
 
+func BenchmarkLongestPrefix(b *testing.B) {
+	ac := NewFixed(toBytes("/", "/api/", "/api/v1/", "/static/"))
+	path := []byte("/api/v1/users/12345")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ac.LongestPrefix(path)
+	}
+}
+
 func BenchmarkManyMatchesFixed(b *testing.B) {
 	b.StopTimer()
 	reader := bytes.NewBuffer(benchmarkValue(100))
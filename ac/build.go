@@ -0,0 +1,246 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ac
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Options control the construction of an Aho-Corasick tree.
+type Options struct {
+	Workers  int            // number of goroutines used to compute the fail links of each level of the tree. Values less than 2 build serially.
+	Progress func(Progress) // if not nil, called every ProgressInterval sequences while inserting, and after each level of fail links
+}
+
+// ProgressInterval is the number of sequences inserted between Progress reports.
+const ProgressInterval = 1 << 16
+
+// Phase is the stage of construction that a Progress report refers to.
+type Phase int
+
+const (
+	Inserting Phase = iota // sequences are being added to the tree
+	Linking                // fail links are being computed
+)
+
+// Progress reports how far a build has got.
+// While Inserting, Done and Total count sequences (Total is -1 if not known in advance).
+// While Linking, Done and Total count nodes.
+type Progress struct {
+	Phase Phase
+	Done  int
+	Total int
+}
+
+// The arena allocates nodes and goto arrays in slabs rather than one at a time.
+// Slabs start small and double in size, up to a maximum, so that small trees stay small.
+// Nodes are identified by their int32 position in the arena and are listed by depth:
+// those lists take the place of the queue in a breadth first traversal.
+const (
+	minSlabBits = 2
+	maxSlabBits = 12
+	maxSlab     = 1 << maxSlabBits
+)
+
+// slot returns the slab, and the position within it, of the nth allocation
+func slot(n int32) (int, int32) {
+	if n < maxSlab {
+		k := bits.Len32(uint32(n) >> minSlabBits)
+		if k == 0 {
+			return 0, n
+		}
+		return k, n - 1<<(minSlabBits+k-1)
+	}
+	return int(n>>maxSlabBits) + maxSlabBits - minSlabBits, n & (maxSlab - 1)
+}
+
+func slabSize(k int) int {
+	switch {
+	case k == 0:
+		return 1 << minSlabBits
+	case k <= maxSlabBits-minSlabBits:
+		return 1 << (minSlabBits + k - 1)
+	}
+	return maxSlab
+}
+
+type arena struct {
+	nodes  [][]Ac
+	gotos  [][][256]*Ac
+	n, g   int32
+	levels [][]int32 // the ids of the nodes at each depth of the tree
+}
+
+func (a *arena) node(id int32) *Ac {
+	k, i := slot(id)
+	return &a.nodes[k][i]
+}
+
+func (a *arena) newNode(val byte, depth int) *Ac {
+	id := a.n
+	k, i := slot(id)
+	if i == 0 {
+		a.nodes = append(a.nodes, make([]Ac, slabSize(k)))
+	}
+	a.n++
+	for len(a.levels) <= depth {
+		a.levels = append(a.levels, nil)
+	}
+	a.levels[depth] = append(a.levels[depth], id)
+	node := &a.nodes[k][i]
+	node.val = val
+	node.trans.gotos = &leaf
+	return node
+}
+
+func (a *arena) newGotos() *[256]*Ac {
+	k, i := slot(a.g)
+	if i == 0 {
+		a.gotos = append(a.gotos, make([][256]*Ac, slabSize(k)))
+	}
+	a.g++
+	return &a.gotos[k][i]
+}
+
+// builder inserts sequences into a tree one at a time, then links the tree once all are in
+type builder struct {
+	arena
+	root  *Ac
+	fixed bool
+	count int // number of sequences inserted
+	total int // expected number of sequences, or -1
+	opts  Options
+}
+
+func newBuilder(fixed bool, opts Options, total int) *builder {
+	b := &builder{fixed: fixed, total: total, opts: opts}
+	b.root = b.newNode(0, 0)
+	return b
+}
+
+func (b *builder) progress(phase Phase, done, total int) {
+	if b.opts.Progress != nil {
+		b.opts.Progress(Progress{phase, done, total})
+	}
+}
+
+// add inserts a sequence. Its index is the number of sequences added before it.
+func (b *builder) add(seq []byte) {
+	curr := b.root
+	for depth, seqByte := range seq {
+		if trans, ok := curr.trans.get(seqByte); ok {
+			curr = trans
+			continue
+		}
+		node := b.newNode(seqByte, depth+1)
+		if b.fixed {
+			node.fail = b.root
+		}
+		if curr.trans.gotos == &leaf {
+			curr.trans.gotos = b.newGotos()
+		}
+		curr.trans.keys = append(curr.trans.keys, seqByte)
+		curr.trans.gotos[seqByte] = node
+		curr = node
+	}
+	curr.out = append(curr.out, [2]int{b.count, len(seq)})
+	b.count++
+	if b.count%ProgressInterval == 0 {
+		b.progress(Inserting, b.count, b.total)
+	}
+}
+
+// finish adds the fail links and returns the root of the tree
+func (b *builder) finish() *Ac {
+	b.progress(Inserting, b.count, b.count)
+	root := b.root
+	root.fail = root
+	if !b.fixed {
+		b.addFails()
+	}
+	b.levels = nil
+	return root
+}
+
+func (b *builder) addFails() {
+	root := b.root
+	// root and its children fail to root
+	for _, k := range root.trans.keys {
+		root.trans.gotos[k].fail = root
+	}
+	done, total := 1+len(root.trans.keys), int(b.n)
+	b.progress(Linking, done, total)
+	// link the tree a level at a time: the children of each level only depend on the fail links of shallower nodes
+	for depth := 1; depth < len(b.levels); depth++ {
+		level := b.levels[depth]
+		if b.opts.Workers < 2 || len(level) < b.opts.Workers*64 {
+			b.linkChildren(level)
+		} else {
+			var wg sync.WaitGroup
+			chunk := (len(level) + b.opts.Workers - 1) / b.opts.Workers
+			for start := 0; start < len(level); start += chunk {
+				end := start + chunk
+				if end > len(level) {
+					end = len(level)
+				}
+				wg.Add(1)
+				go func(ids []int32) {
+					b.linkChildren(ids)
+					wg.Done()
+				}(level[start:end])
+			}
+			wg.Wait()
+		}
+		if depth+1 < len(b.levels) {
+			done += len(b.levels[depth+1])
+		}
+		b.progress(Linking, done, total)
+	}
+}
+
+// linkChildren adds fail and dictionary suffix links to the children of the given nodes
+func (b *builder) linkChildren(ids []int32) {
+	root := b.root
+	for _, id := range ids {
+		pop := b.node(id)
+		for _, key := range pop.trans.keys {
+			node := pop.trans.gotos[key]
+			// starting from the node's parent, follow the fails back towards root,
+			// and stop at the first fail that has a goto to the node's value
+			fail := pop.fail
+			_, ok := fail.trans.get(node.val)
+			for fail != root && !ok {
+				fail = fail.fail
+				_, ok = fail.trans.get(node.val)
+			}
+			fnode, ok := fail.trans.get(node.val)
+			if ok && fnode != node {
+				node.fail = fnode
+			} else {
+				node.fail = root
+			}
+			// the dictionary suffix link is the fail node if it has outputs, otherwise the fail node's own dictionary link.
+			// The fail node is shallower than this node, so its link is already set.
+			if node.fail != root {
+				if len(node.fail.out) > 0 {
+					node.dict = node.fail
+				} else {
+					node.dict = node.fail.dict
+				}
+			}
+		}
+	}
+}
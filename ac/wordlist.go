@@ -0,0 +1,166 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ac
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format is the encoding of the entries in a wordlist.
+type Format int
+
+const (
+	// Text wordlists have one sequence per line. A backslash escapes the following character:
+	// \\, \#, \n, \r, \t, and \xHH (a byte in hex) are recognised.
+	Text Format = iota
+	// Hex wordlists have one hex encoded sequence per line. Spaces and tabs between the digits are ignored.
+	Hex
+)
+
+// maxLine is the longest line a wordlist can contain
+const maxLine = 1 << 20
+
+// WordlistError reports a malformed entry in a wordlist.
+type WordlistError struct {
+	Line int // line number, counting from 1
+	Err  error
+}
+
+func (e *WordlistError) Error() string {
+	return fmt.Sprintf("ac: wordlist line %d: %v", e.Line, e.Err)
+}
+
+func (e *WordlistError) Unwrap() error { return e.Err }
+
+// NewFromWordlist creates an Aho-Corasick tree from a newline delimited wordlist, inserting each entry as it is read.
+// Blank lines, and lines that begin with '#', are skipped. Result indexes count entries only, not skipped lines.
+// A WordlistError is returned for the first malformed entry.
+func NewFromWordlist(r io.Reader, format Format) (*Ac, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLine)
+	var (
+		line int
+		buf  []byte
+		err  error
+	)
+	next := func() ([]byte, bool) {
+		for scanner.Scan() {
+			line++
+			text := scanner.Bytes()
+			if len(text) > 0 && text[len(text)-1] == '\r' {
+				text = text[:len(text)-1]
+			}
+			if len(text) == 0 || text[0] == '#' {
+				continue
+			}
+			if format == Hex {
+				buf, err = decodeHex(buf[:0], text)
+			} else {
+				buf, err = unescape(buf[:0], text)
+			}
+			if err != nil {
+				err = &WordlistError{line, err}
+				return nil, false
+			}
+			return buf, true
+		}
+		if err = scanner.Err(); err != nil {
+			err = &WordlistError{line + 1, err}
+		}
+		return nil, false
+	}
+	ac := NewFromIterator(next)
+	if err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+func hexVal(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func decodeHex(dst, src []byte) ([]byte, error) {
+	var hi byte
+	var half bool
+	for i, c := range src {
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		v, ok := hexVal(c)
+		if !ok {
+			return dst, fmt.Errorf("invalid hex character %q at column %d", c, i+1)
+		}
+		if half {
+			dst = append(dst, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		return dst, errors.New("odd number of hex digits")
+	}
+	return dst, nil
+}
+
+func unescape(dst, src []byte) ([]byte, error) {
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if c != '\\' {
+			dst = append(dst, c)
+			continue
+		}
+		i++
+		if i == len(src) {
+			return dst, fmt.Errorf("trailing backslash at column %d", i)
+		}
+		switch src[i] {
+		case '\\', '#':
+			dst = append(dst, src[i])
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'x':
+			if i+2 >= len(src) {
+				return dst, fmt.Errorf("short \\x escape at column %d", i)
+			}
+			hi, ok1 := hexVal(src[i+1])
+			lo, ok2 := hexVal(src[i+2])
+			if !ok1 || !ok2 {
+				return dst, fmt.Errorf("invalid \\x escape at column %d", i)
+			}
+			dst = append(dst, hi<<4|lo)
+			i += 2
+		default:
+			return dst, fmt.Errorf("unknown escape \\%c at column %d", src[i], i)
+		}
+	}
+	return dst, nil
+}
@@ -18,16 +18,21 @@ package dwac
 // out function
 type out struct {
 	max      int64 // maximum offset at which can occur
+	min      int64 // minimum offset at which can occur
 	seqIndex int   // index within all the Seqs in the Wac
 	subIndex int   // index of the Choice within the Seq
+	alt      int   // index of the byte slice within the Choice
 	length   int   // length of byte slice
 }
 
+// contains reports whether the outputs already have o, from any alternative of its Choice,
+// so that an alternative repeated within a Choice only matches once
 func contains(op []out, o out) bool {
 	if op == nil {
 		return false
 	}
 	for _, o1 := range op {
+		o1.alt = o.alt
 		if o == o1 {
 			return true
 		}
@@ -65,7 +70,7 @@ func (start *node) addGotos(seqs []Seq) (int64, bool) {
 	// iterate through byte sequences adding goto links to the link matrix
 	for id, seq := range seqs {
 		for i, choice := range seq.Choices {
-			for _, byts := range choice {
+			for j, byts := range choice {
 				curr := start
 				for _, byt := range byts {
 					if curr.transit[byt] == nil {
@@ -77,11 +82,10 @@ func (start *node) addGotos(seqs []Seq) (int64, bool) {
 					}
 					curr = curr.transit[byt]
 				}
-				curr.output, curr.outMax, curr.outMaxL = addOutput(
-					curr.output,
-					out{seq.MaxOffsets[i], id, i, len(byts)},
-					curr.outMax,
-					curr.outMaxL)
+				o := out{seq.MaxOffsets[i], seq.minOffset(i), id, i, j, len(byts)}
+				if !contains(curr.output, o) {
+					curr.output, curr.outMax, curr.outMaxL = addOutput(curr.output, o, curr.outMax, curr.outMaxL)
+				}
 				if seq.MaxOffsets[i] > maxOff {
 					maxOff = seq.MaxOffsets[i]
 				}
@@ -97,7 +101,7 @@ func (start *node) addGotos(seqs []Seq) (int64, bool) {
 func (start *node) addGotosIndexes(idxs []SeqIndex, seqs []Seq) {
 	for _, idx := range idxs {
 		for i, choice := range seqs[idx[0]].Choices[idx[1]:] {
-			for _, byts := range choice {
+			for j, byts := range choice {
 				curr := start
 				for _, byt := range byts {
 					if curr.transit[byt] == nil {
@@ -109,11 +113,10 @@ func (start *node) addGotosIndexes(idxs []SeqIndex, seqs []Seq) {
 					}
 					curr = curr.transit[byt]
 				}
-				curr.output, curr.outMax, curr.outMaxL = addOutput(
-					curr.output,
-					out{-1, idx[0], i + idx[1], len(byts)},
-					curr.outMax,
-					curr.outMaxL)
+				o := out{-1, seqs[idx[0]].minOffset(i + idx[1]), idx[0], i + idx[1], j, len(byts)}
+				if !contains(curr.output, o) {
+					curr.output, curr.outMax, curr.outMaxL = addOutput(curr.output, o, curr.outMax, curr.outMaxL)
+				}
 			}
 		}
 	}
@@ -12,16 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// DWAC is a multiple string matching algorithm with choices and max offsets.
+// DWAC is a multiple string matching algorithm with choices and max (and optional min) offsets.
 // It pauses matching when all strings with fixed offsets have been checked.
 // To resume matching (a limited set) of wildcard sequences, send on the resume channel.
 package dwac
 
 import (
-	"fmt"
 	"io"
-	"strings"
 	"sync"
+
+	"github.com/richardlehane/match/internal/seqtext"
 )
 
 // Result contains the index and offset of matches.
@@ -29,42 +29,32 @@ type Result struct {
 	Index  [2]int // a double index: index of the Seq and index of the Choice
 	Offset int64
 	Length int
+	Alt    int // index of the byte slice within the Choice that matched
 }
 
 // Choice represents the different byte slices that can occur at each position of the Seq
 type Choice [][]byte
 
-// Seq is an ordered set of slices of Choices, with maximum offsets for each choice
+// Seq is an ordered set of slices of Choices, with maximum (and optionally minimum) offsets for each choice
 type Seq struct {
 	MaxOffsets []int64 // maximum offsets for each choice. Can be -1 for wildcard.
 	Choices    []Choice
+	MinOffsets []int64 // minimum offsets for each choice. Optional: if nil, or shorter than Choices, the minimum is 0.
+}
+
+// minOffset returns the minimum offset for the Choice at index i
+func (s Seq) minOffset(i int) int64 {
+	if i < len(s.MinOffsets) {
+		return s.MinOffsets[i]
+	}
+	return 0
 }
 
 // SeqIndex is an index into the slice of Seqs and their containing choices used to create the Dwac
 type SeqIndex [2]int
 
 func (s Seq) String() string {
-	str := "{Offsets:"
-	for n, v := range s.MaxOffsets {
-		if n > 0 {
-			str += ","
-		}
-		str += fmt.Sprintf(" %d", v)
-	}
-	str += "; Choices:"
-	for n, v := range s.Choices {
-		if n > 0 {
-			str += ","
-		}
-		str += " ["
-		strs := make([]string, len(v))
-		for i := range v {
-			strs[i] = string(v[i])
-		}
-		str += strings.Join(strs, " | ")
-		str += "]"
-	}
-	return str + "}"
+	return seqtext.Format(s.text())
 }
 
 type Dwac struct {
@@ -116,12 +106,12 @@ func (dwac *Dwac) match(input io.ByteReader, results chan Result, resume chan []
 		}
 		if curr.output != nil && (curr.outMax == -1 || curr.outMax >= offset-int64(curr.outMaxL)) {
 			for _, o := range curr.output {
-				if o.max == -1 || o.max >= offset-int64(o.length) {
+				if (o.max == -1 || o.max >= offset-int64(o.length)) && offset-int64(o.length) >= o.min {
 					if o.subIndex == 0 || (p[o.seqIndex][o.subIndex-1] != 0 && offset-int64(o.length) >= p[o.seqIndex][o.subIndex-1]) {
 						if p[o.seqIndex][o.subIndex] == 0 {
 							p[o.seqIndex][o.subIndex] = offset
 						}
-						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length}
+						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length, Alt: o.alt}
 					}
 				}
 			}
@@ -154,11 +144,14 @@ func (dwac *Dwac) match(input io.ByteReader, results chan Result, resume chan []
 				}
 				if curr.output != nil {
 					for _, o := range curr.output {
+						if offset-int64(o.length) < o.min {
+							continue
+						}
 						if o.subIndex == 0 || (p[o.seqIndex][o.subIndex-1] != 0 && offset-int64(o.length) >= p[o.seqIndex][o.subIndex-1]) {
 							if p[o.seqIndex][o.subIndex] == 0 {
 								p[o.seqIndex][o.subIndex] = offset
 							}
-							results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length}
+							results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length, Alt: o.alt}
 						}
 					}
 				}
@@ -2,6 +2,9 @@ package dwac
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -36,8 +39,8 @@ func test(t *testing.T, a []byte, b []Seq, idx []SeqIndex, expect []Result) {
 // This test checks whether a sequence on with a match at the maximum offset is sent before the resume.
 func TestBorder(t *testing.T) {
 	dwac := New([]Seq{{
-		[]int64{5},
-		[]Choice{{[]byte("hello")}},
+		MaxOffsets: []int64{5},
+		Choices:    []Choice{{[]byte("hello")}},
 	}})
 	output, resume := dwac.Index(bytes.NewBuffer(append([]byte{0, 0, 0, 0, 0}, []byte("hello")...)))
 	results := make([]Result, 0)
@@ -54,7 +57,7 @@ func TestBorder(t *testing.T) {
 }
 
 func seq(s string) Seq {
-	return Seq{[]int64{64}, []Choice{{[]byte(s)}}}
+	return Seq{MaxOffsets: []int64{64}, Choices: []Choice{{[]byte(s)}}}
 }
 
 // Tests (the test strings are taken from John Graham-Cumming's lua implementation: https://github.com/jgrahamc/aho-corasick-lua Copyright (c) 2013 CloudFlare)
@@ -62,7 +65,7 @@ func TestWikipedia(t *testing.T) {
 	test(t, []byte("abccab"),
 		[]Seq{seq("a"), seq("ab"), seq("bc"), seq("bca"), seq("c"), seq("caa")},
 		nil,
-		[]Result{{[2]int{0, 0}, 0, 1}, {[2]int{1, 0}, 0, 2}, {[2]int{2, 0}, 1, 2}, {[2]int{4, 0}, 2, 1}, {[2]int{4, 0}, 3, 1}, {[2]int{0, 0}, 4, 1}, {[2]int{1, 0}, 4, 2}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 1}, {Index: [2]int{1, 0}, Offset: 0, Length: 2}, {Index: [2]int{2, 0}, Offset: 1, Length: 2}, {Index: [2]int{4, 0}, Offset: 2, Length: 1}, {Index: [2]int{4, 0}, Offset: 3, Length: 1}, {Index: [2]int{0, 0}, Offset: 4, Length: 1}, {Index: [2]int{1, 0}, Offset: 4, Length: 2}})
 }
 
 func TestSimple(t *testing.T) {
@@ -71,162 +74,220 @@ func TestSimple(t *testing.T) {
 		nil,
 		[]Result{})
 	test(t, []byte("The pot had a handle The"),
-		[]Seq{{[]int64{0}, []Choice{{[]byte("The")}}}},
+		[]Seq{{MaxOffsets: []int64{0}, Choices: []Choice{{[]byte("The")}}}},
 		nil,
-		[]Result{{[2]int{0, 0}, 0, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot ")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 4}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ot h")},
 		nil,
-		[]Result{{[2]int{0, 0}, 5, 4}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("andle")},
 		nil,
-		[]Result{{[2]int{0, 0}, 15, 5}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 15, Length: 5}})
 }
 
 func TestMultipleNonoverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("h")},
 		nil,
-		[]Result{{[2]int{0, 0}, 1, 1}, {[2]int{0, 0}, 8, 1}, {[2]int{0, 0}, 14, 1}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 1, Length: 1}, {Index: [2]int{0, 0}, Offset: 8, Length: 1}, {Index: [2]int{0, 0}, Offset: 14, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ha"), seq("he")},
 		nil,
-		[]Result{{[2]int{1, 0}, 1, 2}, {[2]int{0, 0}, 8, 2}, {[2]int{0, 0}, 14, 2}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 1, Length: 2}, {Index: [2]int{0, 0}, Offset: 8, Length: 2}, {Index: [2]int{0, 0}, Offset: 14, Length: 2}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 3}, {[2]int{1, 0}, 8, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 3}, {Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had"), seq("hod")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 3}, {[2]int{1, 0}, 8, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 3}, {Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("The"), seq("pot"), seq("had"), seq("hod"), seq("andle")},
 		nil,
-		[]Result{{[2]int{0, 0}, 0, 3}, {[2]int{1, 0}, 4, 3}, {[2]int{2, 0}, 8, 3}, {[2]int{4, 0}, 15, 5}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 3}, {Index: [2]int{1, 0}, Offset: 4, Length: 3}, {Index: [2]int{2, 0}, Offset: 8, Length: 3}, {Index: [2]int{4, 0}, Offset: 15, Length: 5}})
 }
 
 func TestOverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("Th"), seq("he pot"), seq("The"), seq("pot h")},
 		nil,
-		[]Result{{[2]int{0, 0}, 0, 2}, {[2]int{2, 0}, 0, 3}, {[2]int{1, 0}, 1, 6}, {[2]int{3, 0}, 4, 5}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 2}, {Index: [2]int{2, 0}, Offset: 0, Length: 3}, {Index: [2]int{1, 0}, Offset: 1, Length: 6}, {Index: [2]int{3, 0}, Offset: 4, Length: 5}})
 }
 
 func TestNesting(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("and"), seq("andle")},
 		nil,
-		[]Result{{[2]int{1, 0}, 14, 4}, {[2]int{2, 0}, 15, 3}, {[2]int{0, 0}, 14, 6}, {[2]int{3, 0}, 15, 5}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 14, Length: 4}, {Index: [2]int{2, 0}, Offset: 15, Length: 3}, {Index: [2]int{0, 0}, Offset: 14, Length: 6}, {Index: [2]int{3, 0}, Offset: 15, Length: 5}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("an"), seq("n")},
 		nil,
-		[]Result{{[2]int{2, 0}, 15, 2}, {[2]int{3, 0}, 16, 1}, {[2]int{1, 0}, 14, 4}, {[2]int{0, 0}, 14, 6}})
+		[]Result{{Index: [2]int{2, 0}, Offset: 15, Length: 2}, {Index: [2]int{3, 0}, Offset: 16, Length: 1}, {Index: [2]int{1, 0}, Offset: 14, Length: 4}, {Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dle"), seq("l"), seq("le")},
 		nil,
-		[]Result{{[2]int{1, 0}, 18, 1}, {[2]int{0, 0}, 17, 3}, {[2]int{2, 0}, 18, 2}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 18, Length: 1}, {Index: [2]int{0, 0}, Offset: 17, Length: 3}, {Index: [2]int{2, 0}, Offset: 18, Length: 2}})
 }
 
 func TestRandom(t *testing.T) {
 	test(t, []byte("yasherhs"),
 		[]Seq{seq("say"), seq("she"), seq("shr"), seq("he"), seq("her")},
 		nil,
-		[]Result{{[2]int{1, 0}, 2, 3}, {[2]int{3, 0}, 3, 2}, {[2]int{4, 0}, 3, 3}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 2, Length: 3}, {Index: [2]int{3, 0}, Offset: 3, Length: 2}, {Index: [2]int{4, 0}, Offset: 3, Length: 3}})
 }
 
 func TestFailPartial(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dlf"), seq("l")},
 		nil,
-		[]Result{{[2]int{1, 0}, 18, 1}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
 }
 
 func TestMany(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("andle"), seq("ndle"), seq("dle"), seq("le"), seq("e")},
 		nil,
-		[]Result{{[2]int{5, 0}, 2, 1}, {[2]int{0, 0}, 14, 6}, {[2]int{1, 0}, 15, 5}, {[2]int{2, 0}, 16, 4}, {[2]int{3, 0}, 17, 3}, {[2]int{4, 0}, 18, 2}, {[2]int{5, 0}, 19, 1}})
+		[]Result{{Index: [2]int{5, 0}, Offset: 2, Length: 1}, {Index: [2]int{0, 0}, Offset: 14, Length: 6}, {Index: [2]int{1, 0}, Offset: 15, Length: 5}, {Index: [2]int{2, 0}, Offset: 16, Length: 4}, {Index: [2]int{3, 0}, Offset: 17, Length: 3}, {Index: [2]int{4, 0}, Offset: 18, Length: 2}, {Index: [2]int{5, 0}, Offset: 19, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("handl"), seq("hand"), seq("han"), seq("ha"), seq("a")},
 		nil,
-		[]Result{{[2]int{4, 0}, 8, 2}, {[2]int{5, 0}, 9, 1}, {[2]int{5, 0}, 12, 1}, {[2]int{4, 0}, 14, 2}, {[2]int{5, 0}, 15, 1}, {[2]int{3, 0}, 14, 3}, {[2]int{2, 0}, 14, 4}, {[2]int{1, 0}, 14, 5}, {[2]int{0, 0}, 14, 6}})
+		[]Result{{Index: [2]int{4, 0}, Offset: 8, Length: 2}, {Index: [2]int{5, 0}, Offset: 9, Length: 1}, {Index: [2]int{5, 0}, Offset: 12, Length: 1}, {Index: [2]int{4, 0}, Offset: 14, Length: 2}, {Index: [2]int{5, 0}, Offset: 15, Length: 1}, {Index: [2]int{3, 0}, Offset: 14, Length: 3}, {Index: [2]int{2, 0}, Offset: 14, Length: 4}, {Index: [2]int{1, 0}, Offset: 14, Length: 5}, {Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 }
 
 func TestLong(t *testing.T) {
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in")},
 		nil,
-		[]Result{{[2]int{1, 0}, 3, 2}, {[2]int{0, 0}, 1, 8}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 3, Length: 2}, {Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in"), seq("tosh")},
 		nil,
-		[]Result{{[2]int{1, 0}, 3, 2}, {[2]int{0, 0}, 1, 8}, {[2]int{2, 0}, 5, 4}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 3, Length: 2}, {Index: [2]int{0, 0}, Offset: 1, Length: 8}, {Index: [2]int{2, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("into"), seq("to"), seq("in")},
 		nil,
-		[]Result{{[2]int{3, 0}, 3, 2}, {[2]int{1, 0}, 3, 4}, {[2]int{2, 0}, 5, 2}, {[2]int{0, 0}, 1, 8}})
+		[]Result{{Index: [2]int{3, 0}, Offset: 3, Length: 2}, {Index: [2]int{1, 0}, Offset: 3, Length: 4}, {Index: [2]int{2, 0}, Offset: 5, Length: 2}, {Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 }
 
 func TestOffset(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
-		[]Seq{{[]int64{0}, []Choice{{[]byte("pot")}}}, {[]int64{18}, []Choice{{[]byte("l")}}}},
+		[]Seq{{MaxOffsets: []int64{0}, Choices: []Choice{{[]byte("pot")}}}, {MaxOffsets: []int64{18}, Choices: []Choice{{[]byte("l")}}}},
 		nil,
-		[]Result{{[2]int{1, 0}, 18, 1}})
+		[]Result{{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
+}
+
+func TestMinOffset(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{{MaxOffsets: []int64{64}, Choices: []Choice{{[]byte("h")}}, MinOffsets: []int64{5}}, {MaxOffsets: []int64{13}, Choices: []Choice{{[]byte("a")}}, MinOffsets: []int64{10}}},
+		nil,
+		[]Result{{Index: [2]int{0, 0}, Offset: 8, Length: 1}, {Index: [2]int{1, 0}, Offset: 12, Length: 1}, {Index: [2]int{0, 0}, Offset: 14, Length: 1}})
+	test(t, []byte("The pot had a handle"),
+		[]Seq{{MaxOffsets: []int64{0, -1}, Choices: []Choice{{[]byte("The")}, {[]byte("h")}}, MinOffsets: []int64{0, 10}}},
+		[]SeqIndex{{0, 1}},
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 3}, {Index: [2]int{0, 1}, Offset: 14, Length: 1}})
 }
 
 func TestChoices(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{
-			{[]int64{0, 18, -1}, []Choice{{[]byte("The")}, {[]byte("pot")}, {[]byte("l")}}},
-			{[]int64{-1}, []Choice{{[]byte("The")}}},
-			{[]int64{8, -1}, []Choice{{[]byte("had")}, {[]byte("ndle")}}},
+			{MaxOffsets: []int64{0, 18, -1}, Choices: []Choice{{[]byte("The")}, {[]byte("pot")}, {[]byte("l")}}},
+			{MaxOffsets: []int64{-1}, Choices: []Choice{{[]byte("The")}}},
+			{MaxOffsets: []int64{8, -1}, Choices: []Choice{{[]byte("had")}, {[]byte("ndle")}}},
 		},
 		nil,
 		[]Result{
-			{[2]int{0, 0}, 0, 3},
-			{[2]int{1, 0}, 0, 3},
-			{[2]int{0, 1}, 4, 3},
-			{[2]int{2, 0}, 8, 3},
-			{[2]int{0, 2}, 18, 1},
-			{[2]int{2, 1}, 16, 4},
+			{Index: [2]int{0, 0}, Offset: 0, Length: 3},
+			{Index: [2]int{1, 0}, Offset: 0, Length: 3},
+			{Index: [2]int{0, 1}, Offset: 4, Length: 3},
+			{Index: [2]int{2, 0}, Offset: 8, Length: 3},
+			{Index: [2]int{0, 2}, Offset: 18, Length: 1},
+			{Index: [2]int{2, 1}, Offset: 16, Length: 4},
 		})
 }
 
+func TestAlt(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{{MaxOffsets: []int64{-1}, Choices: []Choice{{[]byte("xyz"), []byte("pot"), []byte("had")}}}},
+		[]SeqIndex{{0, 0}},
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 3, Alt: 1}, {Index: [2]int{0, 0}, Offset: 8, Length: 3, Alt: 2}})
+	// an alternative that is repeated only matches once, as the first of its copies
+	test(t, []byte("The pot had a handle"),
+		[]Seq{{MaxOffsets: []int64{-1}, Choices: []Choice{{[]byte("a"), []byte("a"), []byte("ha")}}}},
+		[]SeqIndex{{0, 0}},
+		[]Result{{Index: [2]int{0, 0}, Offset: 8, Length: 2, Alt: 2}, {Index: [2]int{0, 0}, Offset: 9, Length: 1}, {Index: [2]int{0, 0}, Offset: 12, Length: 1}, {Index: [2]int{0, 0}, Offset: 14, Length: 2, Alt: 2}, {Index: [2]int{0, 0}, Offset: 15, Length: 1}})
+}
+
 func TestDynamic(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("poto")},
 		nil,
 		[]Result{})
 	test(t, []byte("The pot had a handle The"),
-		[]Seq{{[]int64{0}, []Choice{{[]byte("The")}}}, {[]int64{-1}, []Choice{{[]byte("had")}}}},
+		[]Seq{{MaxOffsets: []int64{0}, Choices: []Choice{{[]byte("The")}}}, {MaxOffsets: []int64{-1}, Choices: []Choice{{[]byte("had")}}}},
 		[]SeqIndex{{1, 0}},
-		[]Result{{[2]int{0, 0}, 0, 3}, {[2]int{1, 0}, 8, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 0, Length: 3}, {Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 3}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot ")},
 		nil,
-		[]Result{{[2]int{0, 0}, 4, 4}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 4, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ot h")},
 		nil,
-		[]Result{{[2]int{0, 0}, 5, 4}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("andle")},
 		nil,
-		[]Result{{[2]int{0, 0}, 15, 5}})
+		[]Result{{Index: [2]int{0, 0}, Offset: 15, Length: 5}})
+}
+
+func TestMarshal(t *testing.T) {
+	s := Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{{[]byte("PK"), []byte{'P', 'K', 3, 4}, []byte("hex:")}, {[]byte("mime type|")}}, MinOffsets: []int64{0, 16}}
+	byts, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"maxOffsets":[0,-1],"minOffsets":[0,16],"choices":[["PK","hex:504b0304","hex:6865783a"],["mime type|"]]}`
+	if string(byts) != expect {
+		t.Errorf("Marshal fail; Expecting: %s, Got: %s", expect, byts)
+	}
+	var j Seq
+	if err := json.Unmarshal(byts, &j); err != nil || !reflect.DeepEqual(s, j) {
+		t.Errorf("Unmarshal JSON fail; Expecting: %v, Got: %v, %v", s, j, err)
+	}
+	byts, err = s.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txt Seq
+	if err := txt.UnmarshalText(byts); err != nil || !reflect.DeepEqual(s, txt) {
+		t.Errorf("Unmarshal Text fail; Expecting: %v, Got: %v, %v", s, txt, err)
+	}
+	var c Choice
+	if err := c.UnmarshalText([]byte("[a | \\x00]")); err != nil || !reflect.DeepEqual(c, Choice{[]byte("a"), []byte{0}}) {
+		t.Errorf("Unmarshal Text fail for a Choice; Got: %v, %v", c, err)
+	}
+	if err := json.Unmarshal([]byte(`["hex:zz"]`), &c); err == nil {
+		t.Error("Unmarshal JSON fail; Expecting an error for invalid hex")
+	}
+	var pe *ParseError
+	if err := txt.UnmarshalText([]byte("{Offsets: -1; Choices: [a]; Gaps: 1..}")); !errors.As(err, &pe) {
+		t.Errorf("Unmarshal Text fail; Expecting a *ParseError for an unsupported section, Got: %v", err)
+	}
 }
 
 // Benchmarks
@@ -18,13 +18,16 @@
 //
 // This algorithm allows for sequences that are composed of sub-sequences
 // that can contain an arbitrary number of wildcards. Sequences can also be
-// given a maximum offset that defines the maximum byte position of the first sub-sequence.
+// given a maximum offset that defines the maximum byte position of the first sub-sequence,
+// and a minimum offset before which a sub-sequence is not matched.
 //
 // The results returned are for the matches on subsequences (NOT the full sequences).
 // The index of those subsequences and the offset is returned.
 // It is up to clients to verify that the complete sequence that they are interested in has matched.
 // A "progress" result is sent from offset 1024 onwards. This is to update clients on scanning progress and has index -1,-1.
 // This result is sent on powers of two (1024, 2048, 4096, etc.)
+// The scan stops at the end of the input, or as soon as every Seq is past its max offsets (if none has a wildcard).
+// A final result, also with index -1,-1, reports why it stopped.
 
 // Example usage:
 //
@@ -49,54 +52,93 @@
 package fwac
 
 import (
-	"fmt"
 	"io"
 	"sort"
-	"strings"
+
+	"github.com/richardlehane/match/internal/seqtext"
 )
 
 type Wac interface {
 	Index(io.ByteReader) chan Result
 }
 
+// StopWac is a Wac that can report why a scan stopped. The trees made by New, NewLowMem and NewWac are all StopWacs.
+type StopWac interface {
+	Wac
+	IndexStop(io.ByteReader) chan Result
+}
+
 // Result contains the index and offset of matches.
 type Result struct {
 	Index  [2]int // a double index: index of the Seq and index of the Choice
 	Offset int64
 	Length int
+	Alt    int  // index of the byte slice within the Choice that matched
+	Stop   Stop // why the scan stopped: only set on the final result of a scan by IndexStop, which has index -1,-1
+}
+
+// Stop is the reason a scan stopped, as reported by the final result of IndexStop.
+type Stop int
+
+const (
+	Scanning   Stop = iota // the scan hasn't stopped: this is a match or a progress result
+	EndOfInput             // the input was read to its end
+	ReadError              // the input couldn't be read
+	Exhausted              // every Seq was past its max offsets, so the rest of the input wasn't read
+)
+
+func (s Stop) String() string {
+	switch s {
+	case Scanning:
+		return "scanning"
+	case EndOfInput:
+		return "end of input"
+	case ReadError:
+		return "read error"
+	case Exhausted:
+		return "exhausted"
+	}
+	return "unknown"
 }
 
 // Choice represents the different byte slices that can occur at each position of the Seq
 type Choice [][]byte
 
-// Seq is an ordered set of slices of Choices, with maximum offsets for each choice
+// Seq is an ordered set of slices of Choices, with maximum (and optionally minimum) offsets for each choice
 type Seq struct {
 	MaxOffsets []int64 // maximum offsets for each choice. Can be -1 for wildcard.
 	Choices    []Choice
+	MinOffsets []int64 // minimum offsets for each choice. Optional: if nil, or shorter than Choices, the minimum is 0.
 }
 
-func (s Seq) String() string {
-	str := "{Offsets:"
-	for n, v := range s.MaxOffsets {
-		if n > 0 {
-			str += ","
-		}
-		str += fmt.Sprintf(" %d", v)
+// minOffset returns the minimum offset for the Choice at index i
+func (s Seq) minOffset(i int) int64 {
+	if i < len(s.MinOffsets) {
+		return s.MinOffsets[i]
 	}
-	str += "; Choices:"
-	for n, v := range s.Choices {
-		if n > 0 {
-			str += ","
-		}
-		str += " ["
-		strs := make([]string, len(v))
-		for i := range v {
-			strs[i] = string(v[i])
+	return 0
+}
+
+func (s Seq) String() string {
+	return seqtext.Format(s.text())
+}
+
+// limit returns the offset by which every match of the Seqs must have ended, or -1 if any has a wildcard max offset
+func limit(seqs []Seq) int64 {
+	var limit int64
+	for _, seq := range seqs {
+		for i, max := range seq.MaxOffsets {
+			if max < 0 {
+				return -1
+			}
+			for _, byts := range seq.Choices[i] {
+				if end := max + int64(len(byts)); end > limit {
+					limit = end
+				}
+			}
 		}
-		str += strings.Join(strs, " | ")
-		str += "]"
 	}
-	return str + "}"
+	return limit
 }
 
 // New creates an Wild Aho-Corasick tree
@@ -107,9 +149,10 @@ func New(seqs []Seq) Wac {
 	root.addGotos(seqs, false)
 	root.addFails(false)
 	return &fwac{
-		zero: zero,
-		root: root,
-		p:    newPool(seqs),
+		zero:  zero,
+		root:  root,
+		p:     newPool(seqs),
+		limit: limit(seqs),
 	}
 }
 
@@ -119,8 +162,9 @@ func NewLowMem(seqs []Seq) Wac {
 	root.addGotos(seqs, true)
 	root.addFails(false)
 	return &fwaclm{
-		root: root,
-		p:    newPool(seqs),
+		root:  root,
+		p:     newPool(seqs),
+		limit: limit(seqs),
 	}
 }
 
@@ -134,15 +178,17 @@ func NewWac(lm bool, seqs []Seq) Wac {
 
 // fwac is a wild Aho-Corasick tree
 type fwac struct {
-	zero *node
-	root *node
-	p    *pool // pool of preconditions
+	zero  *node
+	root  *node
+	p     *pool // pool of preconditions
+	limit int64 // offset by which every Seq is exhausted, or -1 if any has a wildcard
 }
 
 // fwaclm is a wild Aho-Corasick tree that takes less RAM
 type fwaclm struct {
-	root *nodelm
-	p    *pool // pool of preconditions
+	root  *nodelm
+	p     *pool // pool of preconditions
+	limit int64 // offset by which every Seq is exhausted, or -1 if any has a wildcard
 }
 
 // Nodes
@@ -150,16 +196,21 @@ type fwaclm struct {
 // out function is shared
 type out struct {
 	max      int64 // maximum offset at which can occur
+	min      int64 // minimum offset at which can occur
 	seqIndex int   // index within all the Seqs in the Wac
 	subIndex int   // index of the Choice within the Seq
+	alt      int   // index of the byte slice within the Choice
 	length   int   // length of byte slice
 }
 
+// contains reports whether the outputs already have o, from any alternative of its Choice,
+// so that an alternative repeated within a Choice only matches once
 func contains(op []out, o out) bool {
 	if op == nil {
 		return false
 	}
 	for _, o1 := range op {
+		o1.alt = o.alt
 		if o == o1 {
 			return true
 		}
@@ -199,7 +250,7 @@ func (start *node) addGotos(seqs []Seq, zero bool) {
 			if !zero && i == 0 && seq.MaxOffsets[0] == 0 {
 				continue
 			}
-			for _, byts := range choice {
+			for j, byts := range choice {
 				curr := start
 				for _, byt := range byts {
 					if curr.transit[byt] == nil {
@@ -211,11 +262,10 @@ func (start *node) addGotos(seqs []Seq, zero bool) {
 					}
 					curr = curr.transit[byt]
 				}
-				curr.output, curr.outMax, curr.outMaxL = addOutput(
-					curr.output,
-					out{seq.MaxOffsets[i], id, i, len(byts)},
-					curr.outMax,
-					curr.outMaxL)
+				o := out{seq.MaxOffsets[i], seq.minOffset(i), id, i, j, len(byts)}
+				if !contains(curr.output, o) {
+					curr.output, curr.outMax, curr.outMaxL = addOutput(curr.output, o, curr.outMax, curr.outMaxL)
+				}
 			}
 		}
 	}
@@ -325,7 +375,7 @@ func (start *nodelm) addGotos(seqs []Seq, zero bool) {
 			if !zero && i == 0 && seq.MaxOffsets[0] == 0 {
 				continue
 			}
-			for _, byts := range choice {
+			for j, byts := range choice {
 				curr := start
 				for _, byt := range byts {
 					var n *nodelm
@@ -343,11 +393,10 @@ func (start *nodelm) addGotos(seqs []Seq, zero bool) {
 					}
 					curr = n
 				}
-				curr.output, curr.outMax, curr.outMaxL = addOutput(
-					curr.output,
-					out{seq.MaxOffsets[i], id, i, len(byts)},
-					curr.outMax,
-					curr.outMaxL)
+				o := out{seq.MaxOffsets[i], seq.minOffset(i), id, i, j, len(byts)}
+				if !contains(curr.output, o) {
+					curr.output, curr.outMax, curr.outMaxL = addOutput(curr.output, o, curr.outMax, curr.outMaxL)
+				}
 			}
 		}
 	}
@@ -436,16 +485,25 @@ func clear(p precons) precons {
 // and offsets (in the input byte slice) of matching sequences.
 func (wac *fwac) Index(input io.ByteReader) chan Result {
 	output := make(chan Result)
-	go wac.match(input, output)
+	go wac.match(input, output, false)
 	return output
 }
 
-func (wac *fwac) match(input io.ByteReader, results chan Result) {
+// IndexStop is like Index, but the final result, with index -1,-1, reports why the scan stopped (see Stop).
+func (wac *fwac) IndexStop(input io.ByteReader) chan Result {
+	output := make(chan Result)
+	go wac.match(input, output, true)
+	return output
+}
+
+func (wac *fwac) match(input io.ByteReader, results chan Result, final bool) {
 	var offset int64
 	var progressResult = Result{Index: [2]int{-1, -1}}
 	precons := wac.p.get()
 	curr := wac.zero
-	for c, err := input.ReadByte(); err == nil; c, err = input.ReadByte() {
+	var c byte
+	var err error
+	for c, err = input.ReadByte(); err == nil; c, err = input.ReadByte() {
 		offset++
 		if trans := curr.transit[c]; trans != nil {
 			curr = trans
@@ -461,12 +519,12 @@ func (wac *fwac) match(input io.ByteReader, results chan Result) {
 		}
 		if curr.output != nil && (curr.outMax == -1 || curr.outMax >= offset-int64(curr.outMaxL)) {
 			for _, o := range curr.output {
-				if o.max == -1 || o.max >= offset-int64(o.length) {
+				if (o.max == -1 || o.max >= offset-int64(o.length)) && offset-int64(o.length) >= o.min {
 					if o.subIndex == 0 || (precons[o.seqIndex][o.subIndex-1] != 0 && offset-int64(o.length) >= precons[o.seqIndex][o.subIndex-1]) {
 						if precons[o.seqIndex][o.subIndex] == 0 {
 							precons[o.seqIndex][o.subIndex] = offset
 						}
-						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length}
+						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length, Alt: o.alt}
 					}
 				}
 			}
@@ -475,8 +533,14 @@ func (wac *fwac) match(input io.ByteReader, results chan Result) {
 			progressResult.Offset = offset
 			results <- progressResult
 		}
+		if wac.limit >= 0 && offset >= wac.limit {
+			break
+		}
 	}
 	wac.p.put(precons)
+	if final {
+		results <- Result{Index: [2]int{-1, -1}, Offset: offset, Stop: stop(err)}
+	}
 	close(results)
 }
 
@@ -484,16 +548,25 @@ func (wac *fwac) match(input io.ByteReader, results chan Result) {
 // and offsets (in the input byte slice) of matching sequences.
 func (wac *fwaclm) Index(input io.ByteReader) chan Result {
 	output := make(chan Result)
-	go wac.match(input, output)
+	go wac.match(input, output, false)
 	return output
 }
 
-func (wac *fwaclm) match(input io.ByteReader, results chan Result) {
+// IndexStop is like Index, but the final result, with index -1,-1, reports why the scan stopped (see Stop).
+func (wac *fwaclm) IndexStop(input io.ByteReader) chan Result {
+	output := make(chan Result)
+	go wac.match(input, output, true)
+	return output
+}
+
+func (wac *fwaclm) match(input io.ByteReader, results chan Result, final bool) {
 	var offset int64
 	var progressResult = Result{Index: [2]int{-1, -1}}
 	precons := wac.p.get()
 	curr := wac.root
-	for c, err := input.ReadByte(); err == nil; c, err = input.ReadByte() {
+	var c byte
+	var err error
+	for c, err = input.ReadByte(); err == nil; c, err = input.ReadByte() {
 		offset++
 		if trans := curr.transit.get(c); trans != nil {
 			curr = trans
@@ -509,12 +582,12 @@ func (wac *fwaclm) match(input io.ByteReader, results chan Result) {
 		}
 		if curr.output != nil && (curr.outMax == -1 || curr.outMax >= offset-int64(curr.outMaxL)) {
 			for _, o := range curr.output {
-				if o.max == -1 || o.max >= offset-int64(o.length) {
+				if (o.max == -1 || o.max >= offset-int64(o.length)) && offset-int64(o.length) >= o.min {
 					if o.subIndex == 0 || (precons[o.seqIndex][o.subIndex-1] != 0 && offset-int64(o.length) >= precons[o.seqIndex][o.subIndex-1]) {
 						if precons[o.seqIndex][o.subIndex] == 0 {
 							precons[o.seqIndex][o.subIndex] = offset
 						}
-						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length}
+						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length, Alt: o.alt}
 					}
 				}
 			}
@@ -523,7 +596,24 @@ func (wac *fwaclm) match(input io.ByteReader, results chan Result) {
 			progressResult.Offset = offset
 			results <- progressResult
 		}
+		if wac.limit >= 0 && offset >= wac.limit {
+			break
+		}
 	}
 	wac.p.put(precons)
+	if final {
+		results <- Result{Index: [2]int{-1, -1}, Offset: offset, Stop: stop(err)}
+	}
 	close(results)
 }
+
+// stop returns why a scan stopped, given the last error from reading the input
+func stop(err error) Stop {
+	switch {
+	case err == nil:
+		return Exhausted
+	case err != io.EOF:
+		return ReadError
+	}
+	return EndOfInput
+}
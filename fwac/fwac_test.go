@@ -2,6 +2,9 @@ package fwac
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -17,14 +20,27 @@ func equal(a []Result, b []Result) bool {
 	return true
 }
 
+// loop collects the results of a scan, apart from the final result
 func loop(output chan Result) []Result {
 	results := make([]Result, 0)
 	for res := range output {
+		if res.Stop != Scanning {
+			continue
+		}
 		results = append(results, res)
 	}
 	return results
 }
 
+// final returns the final result of a scan
+func final(output chan Result) Result {
+	var last Result
+	for res := range output {
+		last = res
+	}
+	return last
+}
+
 func test(t *testing.T, a []byte, b []Seq, expect []Result) {
 	wac := New(b)
 	output := wac.Index(bytes.NewBuffer(a))
@@ -41,14 +57,14 @@ func test(t *testing.T, a []byte, b []Seq, expect []Result) {
 }
 
 func seq(s string) Seq {
-	return Seq{[]int64{-1}, []Choice{Choice{[]byte(s)}}}
+	return Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte(s)}}}
 }
 
 // Tests (the test strings are taken from John Graham-Cumming's lua implementation: https://github.com/jgrahamc/aho-corasick-lua Copyright (c) 2013 CloudFlare)
 func TestWikipedia(t *testing.T) {
 	test(t, []byte("abccab"),
 		[]Seq{seq("a"), seq("ab"), seq("bc"), seq("bca"), seq("c"), seq("caa")},
-		[]Result{Result{[2]int{0, 0}, 0, 1}, Result{[2]int{1, 0}, 0, 2}, Result{[2]int{2, 0}, 1, 2}, Result{[2]int{4, 0}, 2, 1}, Result{[2]int{4, 0}, 3, 1}, Result{[2]int{0, 0}, 4, 1}, Result{[2]int{1, 0}, 4, 2}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 0, Length: 2}, Result{Index: [2]int{2, 0}, Offset: 1, Length: 2}, Result{Index: [2]int{4, 0}, Offset: 2, Length: 1}, Result{Index: [2]int{4, 0}, Offset: 3, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 4, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 4, Length: 2}})
 }
 
 func TestSimple(t *testing.T) {
@@ -56,129 +72,213 @@ func TestSimple(t *testing.T) {
 		[]Seq{seq("poto")},
 		[]Result{})
 	test(t, []byte("The pot had a handle The"),
-		[]Seq{Seq{[]int64{0}, []Choice{Choice{[]byte("The")}}}},
-		[]Result{Result{[2]int{0, 0}, 0, 3}})
+		[]Seq{Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("The")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot ")},
-		[]Result{Result{[2]int{0, 0}, 4, 4}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ot h")},
-		[]Result{Result{[2]int{0, 0}, 5, 4}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("andle")},
-		[]Result{Result{[2]int{0, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 15, Length: 5}})
 }
 
 func TestMultipleNonoverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("h")},
-		[]Result{Result{[2]int{0, 0}, 1, 1}, Result{[2]int{0, 0}, 8, 1}, Result{[2]int{0, 0}, 14, 1}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 1, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ha"), seq("he")},
-		[]Result{Result{[2]int{1, 0}, 1, 2}, Result{[2]int{0, 0}, 8, 2}, Result{[2]int{0, 0}, 14, 2}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 1, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 2}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}, Result{[2]int{1, 0}, 8, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had"), seq("hod")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}, Result{[2]int{1, 0}, 8, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("The"), seq("pot"), seq("had"), seq("hod"), seq("andle")},
-		[]Result{Result{[2]int{0, 0}, 0, 3}, Result{[2]int{1, 0}, 4, 3}, Result{[2]int{2, 0}, 8, 3}, Result{[2]int{4, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 8, Length: 3}, Result{Index: [2]int{4, 0}, Offset: 15, Length: 5}})
 }
 
 func TestOverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("Th"), seq("he pot"), seq("The"), seq("pot h")},
-		[]Result{Result{[2]int{0, 0}, 0, 2}, Result{[2]int{2, 0}, 0, 3}, Result{[2]int{1, 0}, 1, 6}, Result{[2]int{3, 0}, 4, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 2}, Result{Index: [2]int{2, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 1, Length: 6}, Result{Index: [2]int{3, 0}, Offset: 4, Length: 5}})
 }
 
 func TestNesting(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("and"), seq("andle")},
-		[]Result{Result{[2]int{1, 0}, 14, 4}, Result{[2]int{2, 0}, 15, 3}, Result{[2]int{0, 0}, 14, 6}, Result{[2]int{3, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{2, 0}, Offset: 15, Length: 3}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}, Result{Index: [2]int{3, 0}, Offset: 15, Length: 5}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("an"), seq("n")},
-		[]Result{Result{[2]int{2, 0}, 15, 2}, Result{[2]int{3, 0}, 16, 1}, Result{[2]int{1, 0}, 14, 4}, Result{[2]int{0, 0}, 14, 6}})
+		[]Result{Result{Index: [2]int{2, 0}, Offset: 15, Length: 2}, Result{Index: [2]int{3, 0}, Offset: 16, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dle"), seq("l"), seq("le")},
-		[]Result{Result{[2]int{1, 0}, 18, 1}, Result{[2]int{0, 0}, 17, 3}, Result{[2]int{2, 0}, 18, 2}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 17, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 18, Length: 2}})
 }
 
 func TestRandom(t *testing.T) {
 	test(t, []byte("yasherhs"),
 		[]Seq{seq("say"), seq("she"), seq("shr"), seq("he"), seq("her")},
-		[]Result{Result{[2]int{1, 0}, 2, 3}, Result{[2]int{3, 0}, 3, 2}, Result{[2]int{4, 0}, 3, 3}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 2, Length: 3}, Result{Index: [2]int{3, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{4, 0}, Offset: 3, Length: 3}})
 }
 
 func TestFailPartial(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dlf"), seq("l")},
-		[]Result{Result{[2]int{1, 0}, 18, 1}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
 }
 
 func TestMany(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("andle"), seq("ndle"), seq("dle"), seq("le"), seq("e")},
-		[]Result{Result{[2]int{5, 0}, 2, 1}, Result{[2]int{0, 0}, 14, 6}, Result{[2]int{1, 0}, 15, 5}, Result{[2]int{2, 0}, 16, 4}, Result{[2]int{3, 0}, 17, 3}, Result{[2]int{4, 0}, 18, 2}, Result{[2]int{5, 0}, 19, 1}})
+		[]Result{Result{Index: [2]int{5, 0}, Offset: 2, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}, Result{Index: [2]int{1, 0}, Offset: 15, Length: 5}, Result{Index: [2]int{2, 0}, Offset: 16, Length: 4}, Result{Index: [2]int{3, 0}, Offset: 17, Length: 3}, Result{Index: [2]int{4, 0}, Offset: 18, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 19, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("handl"), seq("hand"), seq("han"), seq("ha"), seq("a")},
-		[]Result{Result{[2]int{4, 0}, 8, 2}, Result{[2]int{5, 0}, 9, 1}, Result{[2]int{5, 0}, 12, 1}, Result{[2]int{4, 0}, 14, 2}, Result{[2]int{5, 0}, 15, 1}, Result{[2]int{3, 0}, 14, 3}, Result{[2]int{2, 0}, 14, 4}, Result{[2]int{1, 0}, 14, 5}, Result{[2]int{0, 0}, 14, 6}})
+		[]Result{Result{Index: [2]int{4, 0}, Offset: 8, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 9, Length: 1}, Result{Index: [2]int{5, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{4, 0}, Offset: 14, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 15, Length: 1}, Result{Index: [2]int{3, 0}, Offset: 14, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{1, 0}, Offset: 14, Length: 5}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 }
 
 func TestLong(t *testing.T) {
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in")},
-		[]Result{Result{[2]int{1, 0}, 3, 2}, Result{[2]int{0, 0}, 1, 8}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in"), seq("tosh")},
-		[]Result{Result{[2]int{1, 0}, 3, 2}, Result{[2]int{0, 0}, 1, 8}, Result{[2]int{2, 0}, 5, 4}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}, Result{Index: [2]int{2, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("into"), seq("to"), seq("in")},
-		[]Result{Result{[2]int{3, 0}, 3, 2}, Result{[2]int{1, 0}, 3, 4}, Result{[2]int{2, 0}, 5, 2}, Result{[2]int{0, 0}, 1, 8}})
+		[]Result{Result{Index: [2]int{3, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{1, 0}, Offset: 3, Length: 4}, Result{Index: [2]int{2, 0}, Offset: 5, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 }
 
 func TestOffset(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
-		[]Seq{Seq{[]int64{0}, []Choice{Choice{[]byte("pot")}}}, Seq{[]int64{18}, []Choice{Choice{[]byte("l")}}}},
-		[]Result{Result{[2]int{1, 0}, 18, 1}})
+		[]Seq{Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("pot")}}}, Seq{MaxOffsets: []int64{18}, Choices: []Choice{Choice{[]byte("l")}}}},
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
+}
+
+func TestMinOffset(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("h")}}, MinOffsets: []int64{5}}, Seq{MaxOffsets: []int64{13}, Choices: []Choice{Choice{[]byte("a")}}, MinOffsets: []int64{10}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 8, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 1}})
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("h")}}, MinOffsets: []int64{0, 10}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{0, 1}, Offset: 14, Length: 1}})
 }
 
 func TestChoices(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{
-			Seq{[]int64{0, 18, -1}, []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}, Choice{[]byte("l")}}},
-			Seq{[]int64{-1}, []Choice{Choice{[]byte("The")}}},
-			Seq{[]int64{8, -1}, []Choice{Choice{[]byte("had")}, Choice{[]byte("ndle")}}},
+			Seq{MaxOffsets: []int64{0, 18, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}, Choice{[]byte("l")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("The")}}},
+			Seq{MaxOffsets: []int64{8, -1}, Choices: []Choice{Choice{[]byte("had")}, Choice{[]byte("ndle")}}},
 		},
 		[]Result{
-			Result{[2]int{0, 0}, 0, 3},
-			Result{[2]int{1, 0}, 0, 3},
-			Result{[2]int{0, 1}, 4, 3},
-			Result{[2]int{2, 0}, 8, 3},
-			Result{[2]int{0, 2}, 18, 1},
-			Result{[2]int{2, 1}, 16, 4},
+			Result{Index: [2]int{0, 0}, Offset: 0, Length: 3},
+			Result{Index: [2]int{1, 0}, Offset: 0, Length: 3},
+			Result{Index: [2]int{0, 1}, Offset: 4, Length: 3},
+			Result{Index: [2]int{2, 0}, Offset: 8, Length: 3},
+			Result{Index: [2]int{0, 2}, Offset: 18, Length: 1},
+			Result{Index: [2]int{2, 1}, Offset: 16, Length: 4},
 		})
 }
 
+func TestAlt(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("xyz"), []byte("pot"), []byte("had")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3, Alt: 1}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 3, Alt: 2}})
+	// an alternative that is repeated only matches once, as the first of its copies
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("a"), []byte("a"), []byte("ha")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 8, Length: 2, Alt: 2}, Result{Index: [2]int{0, 0}, Offset: 9, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 2, Alt: 2}, Result{Index: [2]int{0, 0}, Offset: 15, Length: 1}})
+}
+
 func TestProgess(t *testing.T) {
 	test(t, make([]byte, 32768),
 		[]Seq{
-			Seq{[]int64{-1}, []Choice{Choice{[]byte("The")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("The")}}},
 		},
 		[]Result{
-			Result{[2]int{-1, -1}, 1024, 0},
-			Result{[2]int{-1, -1}, 2048, 0},
-			Result{[2]int{-1, -1}, 4096, 0},
-			Result{[2]int{-1, -1}, 8192, 0},
-			Result{[2]int{-1, -1}, 16384, 0},
-			Result{[2]int{-1, -1}, 32768, 0},
+			Result{Index: [2]int{-1, -1}, Offset: 1024, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 2048, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 4096, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 8192, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 16384, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 32768, Length: 0},
 		})
 }
 
+func TestStop(t *testing.T) {
+	text := bytes.Repeat([]byte("The pot had a handle "), 1000)
+	bounded := []Seq{
+		Seq{MaxOffsets: []int64{0, 8}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("had")}}},
+		Seq{MaxOffsets: []int64{4}, Choices: []Choice{Choice{[]byte("pot")}}},
+	}
+	wild := append(bounded, seq("pot"))
+	for _, c := range []struct {
+		seqs []Seq
+		read int64
+		stop Stop
+	}{
+		{bounded, 11, Exhausted},
+		{wild, int64(len(text)), EndOfInput},
+	} {
+		expect := Result{Index: [2]int{-1, -1}, Offset: c.read, Stop: c.stop}
+		for _, w := range []Wac{New(c.seqs), NewLowMem(c.seqs)} {
+			if res := final(w.(StopWac).IndexStop(bytes.NewBuffer(text))); res != expect {
+				t.Errorf("Stop fail; Expecting: %v, Got: %v", expect, res)
+			}
+		}
+	}
+	// Index stops early too, but doesn't report why
+	for _, w := range []Wac{New(bounded), NewLowMem(bounded)} {
+		if res := final(w.Index(bytes.NewBuffer(text))); res.Stop != Scanning || res.Index[0] < 0 {
+			t.Errorf("Stop fail; Expecting no final result from Index, Got: %v", res)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s := Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("PK"), []byte{'P', 'K', 3, 4}, []byte("hex:")}, Choice{[]byte("mime type|")}}, MinOffsets: []int64{0, 16}}
+	byts, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"maxOffsets":[0,-1],"minOffsets":[0,16],"choices":[["PK","hex:504b0304","hex:6865783a"],["mime type|"]]}`
+	if string(byts) != expect {
+		t.Errorf("Marshal fail; Expecting: %s, Got: %s", expect, byts)
+	}
+	var j Seq
+	if err := json.Unmarshal(byts, &j); err != nil || !reflect.DeepEqual(s, j) {
+		t.Errorf("Unmarshal JSON fail; Expecting: %v, Got: %v, %v", s, j, err)
+	}
+	byts, err = s.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txt Seq
+	if err := txt.UnmarshalText(byts); err != nil || !reflect.DeepEqual(s, txt) {
+		t.Errorf("Unmarshal Text fail; Expecting: %v, Got: %v, %v", s, txt, err)
+	}
+	var c Choice
+	if err := c.UnmarshalText([]byte("[a | \\x00]")); err != nil || !reflect.DeepEqual(c, Choice{[]byte("a"), []byte{0}}) {
+		t.Errorf("Unmarshal Text fail for a Choice; Got: %v, %v", c, err)
+	}
+	if err := json.Unmarshal([]byte(`["hex:zz"]`), &c); err == nil {
+		t.Error("Unmarshal JSON fail; Expecting an error for invalid hex")
+	}
+	var pe *ParseError
+	if err := txt.UnmarshalText([]byte("{Offsets: -1; Choices: [a]; Gaps: 1..}")); !errors.As(err, &pe) {
+		t.Errorf("Unmarshal Text fail; Expecting a *ParseError for an unsupported section, Got: %v", err)
+	}
+}
+
 // Benchmarks
 func BenchmarkNew(b *testing.B) {
 	for i := 0; i < b.N; i++ {
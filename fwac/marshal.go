@@ -0,0 +1,89 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fwac
+
+import "github.com/richardlehane/match/internal/seqtext"
+
+// ParseError reports the position, in bytes from the start of the input, of a problem parsing a Seq.
+type ParseError = seqtext.ParseError
+
+// The JSON form of a Seq is an object:
+//
+//	{"maxOffsets": [0, -1], "minOffsets": [0, 16], "choices": [["PK", "hex:504b0304"], ["mimetype"]]}
+//
+// The minOffsets member is omitted if there are none. Each Choice is an array of strings, one for each byte slice.
+// Slices of printable ASCII are written as is, unless they begin with "hex:". Any other slice is written as
+// "hex:" followed by its bytes in hex.
+//
+// The text form of a Seq is that produced by Seq.String, and the text form of a Choice is a bracketed,
+// | separated list of byte slices, e.g. [b | c | d]. In text, non-printable bytes are written as \xHH.
+// Text errors are of type *ParseError.
+
+// MarshalJSON implements json.Marshaler.
+func (s Seq) MarshalJSON() ([]byte, error) {
+	return seqtext.MarshalBasic(s.text())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Seq) UnmarshalJSON(data []byte) error {
+	st, err := seqtext.UnmarshalBasic(data)
+	return s.set(st, err)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Seq) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Seq) UnmarshalText(text []byte) error {
+	st, err := seqtext.ParseBasic(string(text))
+	return s.set(st, err)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Choice) MarshalJSON() ([]byte, error) {
+	return seqtext.MarshalChoice(c)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	return seqtext.UnmarshalChoiceTo(c, data)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Choice) MarshalText() ([]byte, error) {
+	return []byte(seqtext.FormatChoice(c)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Choice) UnmarshalText(text []byte) error {
+	return seqtext.ParseChoiceTo(c, string(text))
+}
+
+// text returns the textual parts of the Seq
+func (s Seq) text() seqtext.Seq {
+	return seqtext.FromBasic(s.MaxOffsets, s.MinOffsets, s.Choices)
+}
+
+// set replaces the Seq with the textual parts st, unless there was an error getting them
+func (s *Seq) set(st seqtext.Seq, err error) error {
+	if err != nil {
+		return err
+	}
+	*s = Seq{}
+	s.MaxOffsets, s.MinOffsets, s.Choices = seqtext.ToBasic[Choice](st)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seqtext
+
+import "encoding/json"
+
+// basicJSON is the JSON form of a Seq that has only offsets and choices, as in the fwac and dwac packages
+type basicJSON struct {
+	MaxOffsets []int64      `json:"maxOffsets"`
+	MinOffsets []int64      `json:"minOffsets,omitempty"`
+	Choices    []choiceJSON `json:"choices"`
+}
+
+type choiceJSON [][]byte
+
+func (c choiceJSON) MarshalJSON() ([]byte, error) {
+	return MarshalChoice(c)
+}
+
+func (c *choiceJSON) UnmarshalJSON(data []byte) error {
+	choice, err := UnmarshalChoice(data)
+	if err != nil {
+		return err
+	}
+	*c = choice
+	return nil
+}
+
+// MarshalBasic returns the JSON form of a Seq that has only offsets and choices:
+//
+//	{"maxOffsets": [0, -1], "minOffsets": [0, 16], "choices": [["PK", "hex:504b0304"], ["mimetype"]]}
+//
+// The minOffsets member is omitted if there are none. Each Choice is written as by MarshalChoice.
+func MarshalBasic(s Seq) ([]byte, error) {
+	choices := make([]choiceJSON, len(s.Choices))
+	for i, c := range s.Choices {
+		choices[i] = c
+	}
+	return json.Marshal(basicJSON{s.Max, s.Min, choices})
+}
+
+// UnmarshalBasic reverses MarshalBasic.
+func UnmarshalBasic(data []byte) (Seq, error) {
+	var bj basicJSON
+	if err := json.Unmarshal(data, &bj); err != nil {
+		return Seq{}, err
+	}
+	s := Seq{Max: bj.MaxOffsets, Min: bj.MinOffsets, Choices: make([][][]byte, len(bj.Choices))}
+	for i, c := range bj.Choices {
+		s.Choices[i] = c
+	}
+	return s, nil
+}
+
+// MarshalChoice returns the JSON form of a Choice: an array of strings, one for each byte slice, as written by EncodeBytes.
+func MarshalChoice(c [][]byte) ([]byte, error) {
+	strs := make([]string, len(c))
+	for i, b := range c {
+		strs[i] = EncodeBytes(b)
+	}
+	return json.Marshal(strs)
+}
+
+// UnmarshalChoice reverses MarshalChoice.
+func UnmarshalChoice(data []byte) ([][]byte, error) {
+	var strs []string
+	if err := json.Unmarshal(data, &strs); err != nil {
+		return nil, err
+	}
+	choice := make([][]byte, len(strs))
+	for i, str := range strs {
+		b, err := DecodeBytes(str)
+		if err != nil {
+			return nil, err
+		}
+		choice[i] = b
+	}
+	return choice, nil
+}
+
+// ParseBasic is like Parse, but only accepts the offsets and choices sections.
+func ParseBasic(str string) (Seq, error) {
+	s, err := Parse(str)
+	if err != nil {
+		return Seq{}, err
+	}
+	if s.Extended() {
+		return Seq{}, &ParseError{Pos: 0, Msg: "only offsets and choices are supported"}
+	}
+	return s, nil
+}
+
+// FromBasic returns the parts of a Seq that has only offsets and choices, as in the fwac and dwac packages.
+func FromBasic[C ~[][]byte](max, min []int64, choices []C) Seq {
+	s := Seq{Max: max, Min: min, Choices: make([][][]byte, len(choices))}
+	for i, c := range choices {
+		s.Choices[i] = c
+	}
+	return s
+}
+
+// ToBasic reverses FromBasic. The choices are nil if the Seq has none.
+func ToBasic[C ~[][]byte](s Seq) ([]int64, []int64, []C) {
+	var choices []C
+	if s.Choices != nil {
+		choices = make([]C, len(s.Choices))
+	}
+	for i, c := range s.Choices {
+		choices[i] = c
+	}
+	return s.Max, s.Min, choices
+}
+
+// UnmarshalChoiceTo is UnmarshalChoice, storing the Choice in c.
+func UnmarshalChoiceTo[C ~[][]byte](c *C, data []byte) error {
+	choice, err := UnmarshalChoice(data)
+	if err != nil {
+		return err
+	}
+	*c = choice
+	return nil
+}
+
+// ParseChoiceTo is ParseChoice, storing the Choice in c.
+func ParseChoiceTo[C ~[][]byte](c *C, str string) error {
+	choice, err := ParseChoice(str)
+	if err != nil {
+		return err
+	}
+	*c = choice
+	return nil
+}
@@ -0,0 +1,530 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seqtext implements the textual and JSON forms of the Seqs and Choices
+// of the wac, fwac and dwac packages.
+package seqtext
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Escape renders a byte slice within a Choice. Printable ASCII is written as is, apart from the
+// characters that delimit Choices (\, |, [ and ]), which are preceded by a backslash.
+// Other bytes, and spaces at either end of the slice, are written as \xHH.
+func Escape(b []byte) string {
+	var sb strings.Builder
+	for i, c := range b {
+		switch {
+		case c == '\\' || c == '|' || c == '[' || c == ']':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < ' ' || c > '~' || (c == ' ' && (i == 0 || i == len(b)-1)):
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// FormatChoice renders a Choice as a bracketed, | separated list of escaped byte slices.
+func FormatChoice(c [][]byte) string {
+	strs := make([]string, len(c))
+	for i := range c {
+		strs[i] = Escape(c[i])
+	}
+	return "[" + strings.Join(strs, " | ") + "]"
+}
+
+// Seq holds the parts of a Seq that have a textual form.
+type Seq struct {
+	Max, Min   []int64
+	Choices    [][][]byte
+	Patterns   [][][]byte // the patterns of each Choice, in their own textual form
+	PatternPos [][]int    // when parsed, the position of each pattern in the input, for reporting errors within patterns
+	Exclusions []Exclusion
+	Unordered  [][2]int   // runs of Choices, from a start index up to an end index, that can match in any order
+	Counts     [][2]int64 // the minimum and maximum (or -1) number of times each Choice matches
+	Gaps       [][2]int64 // the minimum and maximum (or -1) gap before each Choice
+}
+
+// Extended reports whether the Seq has any of the sections that only the wac package supports.
+func (s Seq) Extended() bool {
+	return s.Patterns != nil || s.Exclusions != nil || s.Unordered != nil || s.Counts != nil || s.Gaps != nil
+}
+
+// Exclusion is a negative Choice, that follows the Choice at index After within Window bytes.
+type Exclusion struct {
+	After  int
+	Window int64
+	Choice [][]byte
+}
+
+// Format renders a Seq as {Offsets: 5, -1; MinOffsets: 0, 2; Choices: [b | c | d], [ad]}, followed by any of these
+// sections that the Seq has:
+//
+//	; Patterns: [], [50 ?? 30-39]   the patterns of each Choice
+//	; Exclusions: 0+30 [x | y]      the index of the Choice each exclusion follows, + its window, then its Choice
+//	; Unordered: 1:3                the start and end index of each unordered run of Choices
+//	; Counts: 1..1, 0..1, 1..3, 2.. the minimum and maximum count of each Choice (no maximum if there is no limit)
+//	; Gaps: 0.., 4..12              the minimum and maximum gap before each Choice (no maximum if there is no limit)
+//
+// The MinOffsets section is omitted if there are none.
+func Format(s Seq) string {
+	str := "{Offsets:" + formatInts(s.Max)
+	if len(s.Min) > 0 {
+		str += "; MinOffsets:" + formatInts(s.Min)
+	}
+	str += "; Choices:" + formatChoices(s.Choices)
+	if len(s.Patterns) > 0 {
+		str += "; Patterns:" + formatChoices(s.Patterns)
+	}
+	if len(s.Exclusions) > 0 {
+		str += "; Exclusions:"
+		for n, ex := range s.Exclusions {
+			if n > 0 {
+				str += ","
+			}
+			str += fmt.Sprintf(" %d+%d %s", ex.After, ex.Window, FormatChoice(ex.Choice))
+		}
+	}
+	if len(s.Unordered) > 0 {
+		str += "; Unordered:"
+		for n, u := range s.Unordered {
+			if n > 0 {
+				str += ","
+			}
+			str += fmt.Sprintf(" %d:%d", u[0], u[1])
+		}
+	}
+	if len(s.Counts) > 0 {
+		str += "; Counts:" + formatRanges(s.Counts)
+	}
+	if len(s.Gaps) > 0 {
+		str += "; Gaps:" + formatRanges(s.Gaps)
+	}
+	return str + "}"
+}
+
+// formatRanges renders min..max pairs, leaving out a max of -1
+func formatRanges(rngs [][2]int64) string {
+	var str string
+	for n, r := range rngs {
+		if n > 0 {
+			str += ","
+		}
+		str += fmt.Sprintf(" %d..", r[0])
+		if r[1] >= 0 {
+			str += strconv.FormatInt(r[1], 10)
+		}
+	}
+	return str
+}
+
+func formatChoices(choices [][][]byte) string {
+	var str string
+	for n, v := range choices {
+		if n > 0 {
+			str += ","
+		}
+		str += " " + FormatChoice(v)
+	}
+	return str
+}
+
+func formatInts(ints []int64) string {
+	var str string
+	for n, v := range ints {
+		if n > 0 {
+			str += ","
+		}
+		str += fmt.Sprintf(" %d", v)
+	}
+	return str
+}
+
+// ParseError reports the position, in bytes from the start of the input, of a problem parsing a Seq or Choice.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("seq parse error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse parses the form produced by Format. Spaces between tokens are ignored, but are significant within
+// the byte slices of a Choice, except around the | separators. Within a Choice, \xHH is a byte in hex,
+// \n, \r and \t are the usual control characters, and a backslash escapes any other character (such as \| or \]).
+func Parse(str string) (s Seq, err error) {
+	p := &parser{str: str}
+	if err = p.expect("{"); err != nil {
+		return
+	}
+	if err = p.expect("Offsets:"); err != nil {
+		return
+	}
+	if s.Max, err = p.ints(); err != nil {
+		return
+	}
+	if err = p.expect(";"); err != nil {
+		return
+	}
+	if p.accept("MinOffsets:") {
+		if s.Min, err = p.ints(); err != nil {
+			return
+		}
+		if err = p.expect(";"); err != nil {
+			return
+		}
+	}
+	if err = p.expect("Choices:"); err != nil {
+		return
+	}
+	if s.Choices, err = p.choices(); err != nil {
+		return
+	}
+	for p.accept(";") {
+		switch {
+		case p.accept("Patterns:"):
+			p.starts = p.starts[:0]
+			if s.Patterns, err = p.choices(); err == nil {
+				s.PatternPos = make([][]int, len(s.Patterns))
+				for i, ps := range s.Patterns {
+					s.PatternPos[i], p.starts = p.starts[:len(ps):len(ps)], p.starts[len(ps):]
+				}
+			}
+		case p.accept("Exclusions:"):
+			s.Exclusions, err = p.exclusions()
+		case p.accept("Unordered:"):
+			s.Unordered, err = p.spans()
+		case p.accept("Counts:"):
+			s.Counts, err = p.ranges("count")
+		case p.accept("Gaps:"):
+			s.Gaps, err = p.ranges("gap")
+		default:
+			err = p.errorf("expecting a section name")
+		}
+		if err != nil {
+			return
+		}
+	}
+	if err = p.expect("}"); err != nil {
+		return
+	}
+	err = p.end()
+	return
+}
+
+// ParseChoice parses the form produced by FormatChoice.
+func ParseChoice(str string) ([][]byte, error) {
+	p := &parser{str: str}
+	p.space()
+	if p.peek() != '[' {
+		return nil, p.errorf("expecting %q", "[")
+	}
+	c, err := p.choice()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.end()
+}
+
+type parser struct {
+	str    string
+	pos    int
+	starts []int // the position of each byte slice parsed by choice
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return &ParseError{p.pos, fmt.Sprintf(format, a...)}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.str) {
+		return p.str[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) space() {
+	for p.pos < len(p.str) && (p.str[p.pos] == ' ' || p.str[p.pos] == '\t' || p.str[p.pos] == '\n' || p.str[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *parser) end() error {
+	p.space()
+	if p.pos < len(p.str) {
+		return p.errorf("unexpected %q after the end", p.str[p.pos:])
+	}
+	return nil
+}
+
+// accept consumes the literal, and any spaces before it, if it is next in the input
+func (p *parser) accept(lit string) bool {
+	p.space()
+	if strings.HasPrefix(p.str[p.pos:], lit) {
+		p.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(lit string) error {
+	if !p.accept(lit) {
+		if p.pos == len(p.str) {
+			return p.errorf("expecting %q, got end of input", lit)
+		}
+		return p.errorf("expecting %q", lit)
+	}
+	return nil
+}
+
+// ints parses a comma separated list of integers, which may be empty
+func (p *parser) ints() ([]int64, error) {
+	var ret []int64
+	p.space()
+	if c := p.peek(); c != '-' && (c < '0' || c > '9') {
+		return ret, nil
+	}
+	for {
+		i, err := p.int("offset")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, i)
+		if !p.accept(",") {
+			return ret, nil
+		}
+	}
+}
+
+// int parses an integer, described by what in errors
+func (p *parser) int(what string) (int64, error) {
+	p.space()
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+		p.pos++
+	}
+	i, err := strconv.ParseInt(p.str[start:p.pos], 10, 64)
+	if err != nil {
+		text := p.str[start:p.pos]
+		p.pos = start
+		return 0, p.errorf("invalid %s %q", what, text)
+	}
+	return i, nil
+}
+
+// spans parses a comma separated list of start:end pairs
+func (p *parser) spans() ([][2]int, error) {
+	var ret [][2]int
+	for {
+		start, err := p.int("start index")
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		end, err := p.int("end index")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, [2]int{int(start), int(end)})
+		if !p.accept(",") {
+			return ret, nil
+		}
+	}
+}
+
+// ranges parses a comma separated list of min..max pairs, where max can be left out
+func (p *parser) ranges(what string) ([][2]int64, error) {
+	var ret [][2]int64
+	for {
+		min, err := p.int("minimum " + what)
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(".."); err != nil {
+			return nil, err
+		}
+		max := int64(-1)
+		if c := p.peek(); c == '-' || (c >= '0' && c <= '9') {
+			if max, err = p.int("maximum " + what); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, [2]int64{min, max})
+		if !p.accept(",") {
+			return ret, nil
+		}
+	}
+}
+
+// exclusions parses a comma separated list of exclusions, written as after+window [choice]
+func (p *parser) exclusions() ([]Exclusion, error) {
+	var ret []Exclusion
+	for {
+		after, err := p.int("choice index")
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("+"); err != nil {
+			return nil, err
+		}
+		window, err := p.int("window")
+		if err != nil {
+			return nil, err
+		}
+		p.space()
+		if p.peek() != '[' {
+			return nil, p.errorf("expecting %q", "[")
+		}
+		c, err := p.choice()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Exclusion{int(after), window, c})
+		if !p.accept(",") {
+			return ret, nil
+		}
+	}
+}
+
+// choices parses a comma separated list of Choices, which may be empty
+func (p *parser) choices() ([][][]byte, error) {
+	var ret [][][]byte
+	p.space()
+	for p.peek() == '[' {
+		c, err := p.choice()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+		if !p.accept(",") {
+			break
+		}
+		p.space()
+	}
+	return ret, nil
+}
+
+// choice parses a bracketed, | separated list of byte slices
+func (p *parser) choice() ([][]byte, error) {
+	p.pos++ // the opening bracket
+	var c [][]byte
+	p.space()
+	if p.accept("]") {
+		return c, nil
+	}
+	for {
+		p.starts = append(p.starts, p.pos)
+		b, err := p.bytes()
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, b)
+		if p.accept("]") {
+			return c, nil
+		}
+		if err = p.expect("|"); err != nil {
+			return nil, err
+		}
+		p.space()
+	}
+}
+
+// bytes parses a byte slice within a Choice, up to the next unescaped | or ]. Trailing spaces are dropped.
+func (p *parser) bytes() ([]byte, error) {
+	b := []byte{}
+	trim := 0 // length of b without trailing, unescaped, spaces
+	for p.pos < len(p.str) {
+		c := p.str[p.pos]
+		switch c {
+		case '|', ']':
+			return b[:trim], nil
+		case '[':
+			return nil, p.errorf("unescaped '['")
+		case '\\':
+			if p.pos+1 == len(p.str) {
+				return nil, p.errorf("trailing backslash")
+			}
+			switch e := p.str[p.pos+1]; e {
+			case 'x':
+				if p.pos+4 > len(p.str) {
+					return nil, p.errorf("short \\x escape")
+				}
+				v, err := strconv.ParseUint(p.str[p.pos+2:p.pos+4], 16, 8)
+				if err != nil {
+					return nil, p.errorf("invalid \\x escape %q", p.str[p.pos:p.pos+4])
+				}
+				b = append(b, byte(v))
+				p.pos += 4
+			case 'n':
+				b = append(b, '\n')
+				p.pos += 2
+			case 'r':
+				b = append(b, '\r')
+				p.pos += 2
+			case 't':
+				b = append(b, '\t')
+				p.pos += 2
+			default:
+				b = append(b, e)
+				p.pos += 2
+			}
+			trim = len(b)
+		default:
+			b = append(b, c)
+			p.pos++
+			if c != ' ' {
+				trim = len(b)
+			}
+		}
+	}
+	return nil, p.errorf("unterminated choice, expecting ']'")
+}
+
+// hexPrefix marks a JSON string as hex encoded
+const hexPrefix = "hex:"
+
+// EncodeBytes returns the JSON string for a byte slice within a Choice. Slices of printable ASCII are
+// written as is, unless they begin with "hex:". Anything else is written as "hex:" followed by the bytes in hex.
+func EncodeBytes(b []byte) string {
+	if strings.HasPrefix(string(b), hexPrefix) {
+		return hexPrefix + hex.EncodeToString(b)
+	}
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			return hexPrefix + hex.EncodeToString(b)
+		}
+	}
+	return string(b)
+}
+
+// DecodeBytes reverses EncodeBytes.
+func DecodeBytes(s string) ([]byte, error) {
+	if strings.HasPrefix(s, hexPrefix) {
+		return hex.DecodeString(s[len(hexPrefix):])
+	}
+	return []byte(s), nil
+}
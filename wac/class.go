@@ -0,0 +1,349 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Class is a set of byte values that can occur at a position of a Pattern.
+type Class [4]uint64
+
+// Byte returns a Class that matches a single byte.
+func Byte(b byte) Class {
+	var c Class
+	c[b>>6] |= 1 << (b & 63)
+	return c
+}
+
+// Range returns a Class that matches the bytes from lo to hi inclusive.
+func Range(lo, hi byte) Class {
+	var c Class
+	for i := int(lo); i <= int(hi); i++ {
+		c[i>>6] |= 1 << (uint(i) & 63)
+	}
+	return c
+}
+
+// Mask returns a Class that matches the bytes b for which b&mask == value.
+func Mask(mask, value byte) Class {
+	var c Class
+	for i := 0; i < 256; i++ {
+		if byte(i)&mask == value {
+			c[i>>6] |= 1 << (uint(i) & 63)
+		}
+	}
+	return c
+}
+
+// Any returns a Class that matches every byte: the ?? wildcard.
+func Any() Class {
+	return Class{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}
+}
+
+// Not returns the Class of the bytes that c doesn't match.
+func (c Class) Not() Class {
+	return Class{^c[0], ^c[1], ^c[2], ^c[3]}
+}
+
+// Union returns the Class of the bytes that either c or d match.
+func (c Class) Union(d Class) Class {
+	return Class{c[0] | d[0], c[1] | d[1], c[2] | d[2], c[3] | d[3]}
+}
+
+// Contains reports whether c matches b.
+func (c Class) Contains(b byte) bool {
+	return c[b>>6]&(1<<(b&63)) != 0
+}
+
+func (c Class) count() int {
+	return bits.OnesCount64(c[0]) + bits.OnesCount64(c[1]) + bits.OnesCount64(c[2]) + bits.OnesCount64(c[3])
+}
+
+func (c Class) members() []byte {
+	ret := make([]byte, 0, c.count())
+	for i := 0; i < 256; i++ {
+		if c.Contains(byte(i)) {
+			ret = append(ret, byte(i))
+		}
+	}
+	return ret
+}
+
+// ranges returns the class as a list of inclusive ranges
+func (c Class) ranges() [][2]byte {
+	var ret [][2]byte
+	for i := 0; i < 256; i++ {
+		if !c.Contains(byte(i)) {
+			continue
+		}
+		j := i
+		for j < 255 && c.Contains(byte(j+1)) {
+			j++
+		}
+		ret = append(ret, [2]byte{byte(i), byte(j)})
+		i = j
+	}
+	return ret
+}
+
+// mask returns the mask and value that describe the class, if there are any
+func (c Class) mask() (byte, byte, bool) {
+	members := c.members()
+	if len(members) == 0 {
+		return 0, 0, false
+	}
+	var vary byte
+	for _, m := range members {
+		vary |= m ^ members[0]
+	}
+	mask := ^vary
+	if c != Mask(mask, members[0]&mask) {
+		return 0, 0, false
+	}
+	return mask, members[0] & mask, true
+}
+
+func formatRanges(rngs [][2]byte) string {
+	strs := make([]string, len(rngs))
+	for i, r := range rngs {
+		if r[0] == r[1] {
+			strs[i] = fmt.Sprintf("%02x", r[0])
+		} else {
+			strs[i] = fmt.Sprintf("%02x-%02x", r[0], r[1])
+		}
+	}
+	return strings.Join(strs, ",")
+}
+
+// String renders the class in the syntax of ParsePattern.
+func (c Class) String() string {
+	if c == Any() {
+		return "??"
+	}
+	str := formatRanges(c.ranges())
+	if not := "!" + formatRanges(c.Not().ranges()); len(not) < len(str) {
+		str = not
+	}
+	if mask, value, ok := c.mask(); ok {
+		if m := fmt.Sprintf("&%02x=%02x", mask, value); len(m) < len(str) {
+			str = m
+		}
+	}
+	return str
+}
+
+// Pattern is a sequence of byte Classes. Patterns are given in a Seq's Patterns, as alternatives within a Choice
+// that can match more than one byte value at some positions.
+//
+// A pattern whose alternatives are few is expanded into byte slices in the tree. Otherwise the longest run of
+// single byte Classes is put in the tree as an anchor and the rest of the pattern is verified once the anchor matches.
+// Patterns that have many alternatives must have at least one single byte Class.
+type Pattern []Class
+
+// maxExpand is the largest number of byte slices a pattern will be expanded into
+const maxExpand = 64
+
+// expansions returns the number of byte slices the pattern would expand into, up to maxExpand+1
+func (p Pattern) expansions() int {
+	n := 1
+	for _, c := range p {
+		n *= c.count()
+		if n > maxExpand {
+			return maxExpand + 1
+		}
+	}
+	return n
+}
+
+func (p Pattern) expand() [][]byte {
+	ret := [][]byte{{}}
+	for _, c := range p {
+		members := c.members()
+		next := make([][]byte, 0, len(ret)*len(members))
+		for _, r := range ret {
+			for _, m := range members {
+				next = append(next, append(append(make([]byte, 0, len(p)), r...), m))
+			}
+		}
+		ret = next
+	}
+	return ret
+}
+
+// anchor returns the start and end of the longest run of single byte classes (the rightmost, if there is a tie)
+func (p Pattern) anchor() (int, int) {
+	var start, end, s int
+	for i, c := range p {
+		if c.count() != 1 {
+			s = i + 1
+			continue
+		}
+		if i+1-s >= end-start {
+			start, end = s, i+1
+		}
+	}
+	return start, end
+}
+
+func (p Pattern) reverse() Pattern {
+	r := make(Pattern, len(p))
+	for i, c := range p {
+		r[len(p)-1-i] = c
+	}
+	return r
+}
+
+func (p Pattern) validate() string {
+	if len(p) == 0 {
+		return "empty pattern"
+	}
+	for i, c := range p {
+		if c.count() == 0 {
+			return fmt.Sprintf("empty class at position %d", i)
+		}
+	}
+	if s, e := p.anchor(); s == e && p.expansions() > maxExpand {
+		return "pattern has no single byte to anchor it, and too many alternatives to expand"
+	}
+	return ""
+}
+
+// String renders the pattern in the syntax of ParsePattern, with runs of single bytes written together.
+func (p Pattern) String() string {
+	var strs []string
+	var run string
+	for _, c := range p {
+		if c.count() == 1 {
+			run += fmt.Sprintf("%02x", c.members()[0])
+			continue
+		}
+		if run != "" {
+			strs = append(strs, run)
+			run = ""
+		}
+		strs = append(strs, c.String())
+	}
+	if run != "" {
+		strs = append(strs, run)
+	}
+	return strings.Join(strs, " ")
+}
+
+// ParsePattern parses a Pattern from space separated tokens. Each token is one of:
+//
+//	504b        bytes in hex
+//	??          any byte
+//	30-39       a range of bytes
+//	30,32,41-46 a set of bytes and ranges
+//	&f0=30      the bytes b for which b&f0 == 30
+//
+// A set, range, single byte or mask can be negated with a leading '!', e.g. !00 or !30-39.
+func ParsePattern(str string) (Pattern, error) {
+	p, _, err := parsePattern(str)
+	return p, err
+}
+
+// parsePattern is ParsePattern, but also returns the position in str of the token that couldn't be parsed
+func parsePattern(str string) (Pattern, int, error) {
+	var p Pattern
+	for pos := 0; pos < len(str); {
+		if str[pos] == ' ' || str[pos] == '\t' || str[pos] == '\n' || str[pos] == '\r' {
+			pos++
+			continue
+		}
+		start := pos
+		for pos < len(str) && str[pos] != ' ' && str[pos] != '\t' && str[pos] != '\n' && str[pos] != '\r' {
+			pos++
+		}
+		tok := str[start:pos]
+		if tok == "??" {
+			p = append(p, Any())
+			continue
+		}
+		neg := strings.HasPrefix(tok, "!")
+		body := strings.TrimPrefix(tok, "!")
+		if !neg && !strings.ContainsAny(body, "-,&") && len(body) > 2 {
+			if len(body)%2 != 0 {
+				return nil, start, fmt.Errorf("wac: invalid pattern token %q: odd number of hex digits", tok)
+			}
+			for i := 0; i < len(body); i += 2 {
+				b, err := strconv.ParseUint(body[i:i+2], 16, 8)
+				if err != nil {
+					return nil, start, fmt.Errorf("wac: invalid pattern token %q", tok)
+				}
+				p = append(p, Byte(byte(b)))
+			}
+			continue
+		}
+		c, err := parseClass(body)
+		if err != nil {
+			return nil, start, fmt.Errorf("wac: invalid pattern token %q", tok)
+		}
+		if neg {
+			c = c.Not()
+		}
+		p = append(p, c)
+	}
+	return p, 0, nil
+}
+
+func parseHexByte(s string) (byte, error) {
+	if len(s) != 2 {
+		return 0, strconv.ErrSyntax
+	}
+	b, err := strconv.ParseUint(s, 16, 8)
+	return byte(b), err
+}
+
+func parseClass(s string) (Class, error) {
+	var c Class
+	if strings.HasPrefix(s, "&") {
+		parts := strings.Split(s[1:], "=")
+		if len(parts) != 2 {
+			return c, strconv.ErrSyntax
+		}
+		mask, err := parseHexByte(parts[0])
+		if err != nil {
+			return c, err
+		}
+		value, err := parseHexByte(parts[1])
+		if err != nil {
+			return c, err
+		}
+		return Mask(mask, value), nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		bounds := strings.Split(item, "-")
+		if len(bounds) > 2 {
+			return c, strconv.ErrSyntax
+		}
+		lo, err := parseHexByte(bounds[0])
+		if err != nil {
+			return c, err
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = parseHexByte(bounds[1]); err != nil {
+				return c, err
+			}
+		}
+		c = c.Union(Range(lo, hi))
+	}
+	return c, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+// Count is the number of times a Choice can match within a Seq. A Choice with a Min of 0 is optional:
+// the Choices that follow it can match whether it has or not. A Choice with a Min greater than 1 is repeated:
+// the Choices that follow it can only match once it has matched Min times, with repetitions that don't overlap.
+// Max is the most matches that are reported for the Choice, or -1 for no limit.
+type Count struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// count returns the Count for the Choice at index i
+func (s Seq) count(i int) Count {
+	if i < len(s.Counts) {
+		return s.Counts[i]
+	}
+	return Count{1, -1}
+}
+
+// Gap is the distance, in bytes, from the end of a match of the Choice before to the start of a match of a Choice.
+// Max is -1 for no limit. The gap of the first Choice is ignored. For a Choice that follows an unordered group,
+// the gap must be met for every Choice in the group. For a Choice that follows an optional Choice that didn't match,
+// the optional Choice's gap applies instead.
+type Gap struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// anyGap is the gap of a Choice without a Gap
+var anyGap = Gap{0, -1}
+
+// gap returns the Gap before the Choice at index i
+func (s Seq) gap(i int) Gap {
+	if i < len(s.Gaps) {
+		return s.Gaps[i]
+	}
+	return anyGap
+}
+
+// within reports whether a match starting at offset falls within the gap after a match ending at end
+func (g Gap) within(end, offset int64) bool {
+	return end != 0 && end <= offset && offset-end >= g.Min && (g.Max < 0 || offset-end <= g.Max)
+}
+
+// step describes how a Choice fits within its Seq, for checking preconditions
+type step struct {
+	from, to int // the range of Choices whose matches are its preconditions. From is -1 if there are none.
+	gap      Gap
+	Count
+}
+
+func newSteps(seqs []Seq) [][]step {
+	steps := make([][]step, len(seqs))
+	for i, seq := range seqs {
+		steps[i] = make([]step, len(seq.Choices))
+		for j := range seq.Choices {
+			steps[i][j].from, steps[i][j].to = seq.prev(j)
+			steps[i][j].gap = seq.gap(j)
+			steps[i][j].Count = seq.count(j)
+		}
+	}
+	return steps
+}
+
+// met reports whether the preconditions of the Choice at index sub, for a match starting at offset, are met
+func (p precons) met(steps []step, seq, sub int, offset int64) bool {
+	st := steps[sub]
+	if st.from < 0 {
+		return true
+	}
+	for i := st.from; i <= st.to; i++ {
+		if !p.reached(steps, seq, i, offset, st.gap) {
+			return false
+		}
+	}
+	return true
+}
+
+// reached reports whether the Choice at index sub has matched enough times, within the gap before offset,
+// or can be skipped because it is optional and its own preconditions are met.
+// The gap is measured from the match that completed the count, or any later match that is still a candidate.
+func (p precons) reached(steps []step, seq, sub int, offset int64, gap Gap) bool {
+	pc := &p[seq][sub]
+	if gap.within(pc.done, offset) {
+		return true
+	}
+	if pc.done != 0 && gap != anyGap {
+		if pc.last > pc.done && gap.within(pc.last, offset) {
+			return true
+		}
+		for _, end := range pc.ends {
+			if end > pc.done && gap.within(end, offset) {
+				return true
+			}
+		}
+	}
+	return steps[sub].Min == 0 && p.met(steps, seq, sub, offset)
+}
+
+// record counts a match of the Choice at index sub, ending at offset and of the given length,
+// and reports whether it should be sent and whether it is the first match recorded.
+// Up to candidates of the most recent matches are kept for measuring gaps.
+func (p precons) record(st step, seq, sub int, offset int64, length, candidates int) (send, first bool) {
+	pc := &p[seq][sub]
+	counted := offset-int64(length) >= pc.last
+	if st.Max >= 0 && (!counted || pc.count >= st.Max) {
+		return false, false
+	}
+	if pc.first == 0 {
+		pc.first = offset
+		first = true
+	}
+	if counted {
+		pc.count++
+		pc.last = offset
+		if pc.done == 0 && pc.count >= st.Min {
+			pc.done = offset
+		}
+	}
+	if candidates > 0 {
+		if len(pc.ends) == candidates {
+			copy(pc.ends, pc.ends[1:])
+			pc.ends = pc.ends[:candidates-1]
+		}
+		pc.ends = append(pc.ends, offset)
+	}
+	return true, first
+}
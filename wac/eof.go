@@ -0,0 +1,147 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import "io"
+
+// EOF is a Wild Aho-Corasick tree for Seqs that are anchored to the end of the input.
+//
+// The Seqs are given as usual, but their offsets are measured back from the end of the input to the end of each Choice,
+// and their Choices are ordered from the end of the input backwards: the first Choice is the one nearest the end.
+// The byte slices within each Choice are written in their natural (forward) order.
+// The tree is built from the reversed byte slices, and the input is read backwards from its end.
+type EOF struct {
+	wac   *Wac
+	limit int64 // the most bytes that need to be read from the end of the input, or -1 for all
+}
+
+// NewEOF creates a Wild Aho-Corasick tree for EOF anchored Seqs.
+func NewEOF(seqs []Seq) *EOF {
+	rev := make([]Seq, len(seqs))
+	var limit int64
+	for i, seq := range seqs {
+		rev[i] = Seq{
+			MaxOffsets: seq.MaxOffsets,
+			Choices:    make([]Choice, len(seq.Choices)),
+			MinOffsets: seq.MinOffsets,
+			Unordered:  seq.Unordered,
+			Counts:     seq.Counts,
+			Gaps:       seq.Gaps,
+		}
+		if seq.Patterns != nil {
+			rev[i].Patterns = make([][]Pattern, len(seq.Patterns))
+		}
+		for j, choice := range seq.Choices {
+			hold := int(seq.hold(j)) // read far enough to see any exclusions
+			rev[i].Choices[j] = make(Choice, len(choice))
+			for k, byts := range choice {
+				rev[i].Choices[j][k] = reverse(byts)
+				limit = eofLimit(limit, seq.MaxOffsets[j], len(byts)+hold)
+			}
+			for _, p := range seq.patterns(j) {
+				rev[i].Patterns[j] = append(rev[i].Patterns[j], p.reverse())
+				limit = eofLimit(limit, seq.MaxOffsets[j], len(p)+hold)
+			}
+		}
+		for _, ex := range seq.Exclusions {
+			rex := Exclusion{After: ex.After, Window: ex.Window, Choice: make(Choice, len(ex.Choice))}
+			for k, byts := range ex.Choice {
+				rex.Choice[k] = reverse(byts)
+			}
+			rev[i].Exclusions = append(rev[i].Exclusions, rex)
+		}
+	}
+	return &EOF{New(rev), limit}
+}
+
+// eofLimit extends the limit to cover an element of length l with the given max offset
+func eofLimit(limit, max int64, l int) int64 {
+	if limit < 0 || max < 0 {
+		return -1
+	}
+	if end := max + int64(l); end > limit {
+		return end
+	}
+	return limit
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+// Index returns a channel of results for an input of the given size.
+// The input is read backwards from its end, and no further back than the largest max offset allows.
+// Result offsets are the distance from the end of the input to the end of the match: use Abs to convert them.
+// Progress results have an offset that is the number of bytes read from the end.
+func (e *EOF) Index(input io.ReaderAt, size int64) chan Result {
+	limit := size
+	if e.limit >= 0 && e.limit < size {
+		limit = e.limit
+	}
+	return e.wac.Index(newReverseReader(input, size, limit))
+}
+
+// Abs converts the offset of a Result from an EOF tree into an absolute position (of the start of the match)
+// within an input of the given size.
+func (r Result) Abs(size int64) int64 {
+	return size - r.Offset - int64(r.Length)
+}
+
+const reverseBuf = 4096
+
+// reverseReader is a ByteReader that reads an io.ReaderAt backwards from an offset, for up to limit bytes.
+type reverseReader struct {
+	rdr   io.ReaderAt
+	off   int64 // offset of the start of the buffer
+	limit int64 // bytes remaining to be read into the buffer
+	buf   []byte
+	i     int
+}
+
+func newReverseReader(rdr io.ReaderAt, off, limit int64) *reverseReader {
+	return &reverseReader{rdr: rdr, off: off, limit: limit}
+}
+
+func (r *reverseReader) ReadByte() (byte, error) {
+	if r.i == 0 {
+		if r.limit == 0 {
+			return 0, io.EOF
+		}
+		n := int64(reverseBuf)
+		if n > r.limit {
+			n = r.limit
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, n)
+		}
+		r.off -= n
+		r.limit -= n
+		got, err := r.rdr.ReadAt(r.buf[:n], r.off)
+		if int64(got) < n {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			r.limit = 0
+			return 0, err
+		}
+		r.i = int(n)
+	}
+	r.i--
+	return r.buf[r.i], nil
+}
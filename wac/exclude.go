@@ -0,0 +1,53 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+// Exclusion is a negative Choice: a match of the Choice at index After is vetoed if any of the Exclusion's
+// byte slices begins within Window bytes of the end of that match. A vetoed match isn't reported, and isn't
+// recorded as a precondition for the Choices that follow.
+//
+// E.g. a ZIP local header that isn't followed by "mimetype" within 30 bytes:
+//
+//	Seq{
+//	  MaxOffsets: []int64{0},
+//	  Choices:    []Choice{{[]byte("PK\x03\x04")}},
+//	  Exclusions: []Exclusion{{After: 0, Window: 30, Choice: Choice{[]byte("mimetype")}}},
+//	}
+//
+// Matches of a Choice with exclusions are held back until its window has passed, or the input has ended,
+// so they are reported later than other matches. The Choices that follow it are held back with it.
+// In an EOF tree, the window is measured in the direction of the scan: back towards the start of the input.
+type Exclusion struct {
+	After  int    `json:"after"`
+	Window int64  `json:"window"`
+	Choice Choice `json:"choice"`
+}
+
+// hold returns how long matches of the Choice at index i must be held back to see any exclusions that follow them,
+// or 0 if it has none
+func (s Seq) hold(i int) int64 {
+	var hold int64
+	for _, ex := range s.Exclusions {
+		if ex.After != i {
+			continue
+		}
+		for _, byts := range ex.Choice {
+			if h := ex.Window + int64(len(byts)); h > hold {
+				hold = h
+			}
+		}
+	}
+	return hold
+}
@@ -0,0 +1,151 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import "sort"
+
+// NewFlat creates a Wild Aho-Corasick tree that is stored in flat slices, free of pointers.
+// Nodes are addressed by int32 IDs, and share a single array of outputs, so the garbage collector doesn't need
+// to trace the tree: for large sets of Seqs, in long running processes, this keeps GC pauses short.
+// Like NewAdaptive, nodes near the root, or with many links, have an array of gotos and the rest have sorted keys.
+// It is used just like the other trees.
+func NewFlat(seqs []Seq) *Wac {
+	wac := newWac(seqs, newTransAdaptive, newTransAdaptive)
+	wac.flat = newFlat(wac.zero, wac.root)
+	wac.zero, wac.root = nil, nil
+	return wac
+}
+
+// flat is a tree stored without pointers. ID 0 stands for no node, so that empty gotos are zero.
+type flat struct {
+	zero   int32
+	root   int32
+	nodes  []flatNode
+	gotos  []int32 // the gotos of dense nodes: 256 for each, indexed by byte value
+	keys   []byte  // the sorted keys of sparse nodes
+	sparse []int32 // the gotos of sparse nodes, for each of their keys
+	outs   []out   // the outputs of all the nodes
+}
+
+type flatNode struct {
+	fail    int32 // the fail function
+	dense   int32 // index of the node's gotos, or -1 if it is sparse
+	keys    int32 // index of the node's keys, and their gotos, if it is sparse
+	nkeys   int32
+	out     int32 // index of the node's outputs
+	nout    int32
+	outMaxL int32
+	outMax  int64
+}
+
+// newFlat copies the zero and root trees into a flat tree, in breadth first order
+func newFlat(zero, root *node) *flat {
+	f := &flat{nodes: make([]flatNode, 1, 1024)}
+	ids := make(map[*node]int32)
+	var order []*node
+	var depths []int
+	add := func(n *node, depth int) {
+		if _, ok := ids[n]; !ok {
+			ids[n] = int32(len(order) + 1)
+			order = append(order, n)
+			depths = append(depths, depth)
+		}
+	}
+	add(zero, 0)
+	add(root, 0)
+	for i := 0; i < len(order); i++ {
+		for j := 0; ; j++ {
+			n := order[i].transit.iter(j)
+			if n == nil {
+				break
+			}
+			add(n, depths[i]+1)
+		}
+	}
+	var children []*node
+	for i, n := range order {
+		fn := flatNode{
+			fail:    ids[n.fail],
+			dense:   -1,
+			out:     int32(len(f.outs)),
+			nout:    int32(len(n.output)),
+			outMaxL: int32(n.outMaxL),
+			outMax:  n.outMax,
+		}
+		f.outs = append(f.outs, n.output...)
+		children = children[:0]
+		for j := 0; ; j++ {
+			c := n.transit.iter(j)
+			if c == nil {
+				break
+			}
+			children = append(children, c)
+		}
+		if depths[i] <= denseDepth || len(children) >= denseFanout {
+			fn.dense = int32(len(f.gotos))
+			f.gotos = append(f.gotos, make([]int32, 256)...)
+			for _, c := range children {
+				f.gotos[int(fn.dense)+int(c.val)] = ids[c]
+			}
+		} else {
+			sort.Slice(children, func(a, b int) bool { return children[a].val < children[b].val })
+			fn.keys, fn.nkeys = int32(len(f.keys)), int32(len(children))
+			for _, c := range children {
+				f.keys = append(f.keys, c.val)
+				f.sparse = append(f.sparse, ids[c])
+			}
+		}
+		f.nodes = append(f.nodes, fn)
+	}
+	f.zero, f.root = ids[zero], ids[root]
+	return f
+}
+
+// get returns the goto of node n for byte b, or 0 if there is none
+func (f *flat) get(n int32, b byte) int32 {
+	fn := &f.nodes[n]
+	if fn.dense >= 0 {
+		return f.gotos[fn.dense+int32(b)]
+	}
+	for i := fn.keys; i < fn.keys+fn.nkeys; i++ {
+		if f.keys[i] == b {
+			return f.sparse[i]
+		}
+	}
+	return 0
+}
+
+// next returns the node reached from curr on byte b, following fail links as needed
+func (f *flat) next(curr int32, b byte) int32 {
+	if n := f.get(curr, b); n != 0 {
+		return n
+	}
+	for curr != f.root {
+		curr = f.nodes[curr].fail
+		if n := f.get(curr, b); n != 0 {
+			return n
+		}
+	}
+	return curr
+}
+
+// output returns the outputs of node n
+func (f *flat) output(n int32) ([]out, int64, int) {
+	fn := &f.nodes[n]
+	if fn.nout == 0 {
+		return nil, 0, 0
+	}
+	return f.outs[fn.out : fn.out+fn.nout], fn.outMax, int(fn.outMaxL)
+}
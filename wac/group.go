@@ -0,0 +1,44 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+// Group is a run of a Seq's Choices, from index Start up to (but not including) index End, that can match in any order.
+// Each Choice in the group must follow the Choice before the group, and the Choice after the group must follow
+// every Choice in it.
+type Group struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// prev returns the range of Choices, from and to inclusive, whose matches are the preconditions
+// for the Choice at index i. From is -1 if there are none.
+func (s Seq) prev(i int) (int, int) {
+	for _, g := range s.Unordered {
+		if i >= g.Start && i < g.End {
+			return s.before(g.Start)
+		}
+	}
+	return s.before(i)
+}
+
+// before returns the range of Choices that immediately precede index i: a whole group, if one ends there
+func (s Seq) before(i int) (int, int) {
+	for _, g := range s.Unordered {
+		if i == g.End {
+			return g.Start, g.End - 1
+		}
+	}
+	return i - 1, i - 1
+}
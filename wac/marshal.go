@@ -0,0 +1,115 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import (
+	"encoding/json"
+
+	"github.com/richardlehane/match/internal/seqtext"
+)
+
+// The JSON form of a Seq is an object:
+//
+//	{"maxOffsets": [0, -1], "minOffsets": [0, 16], "choices": [["PK", "hex:504b0304"], ["mimetype"]]}
+//
+// Each Choice is an array of strings, one for each byte slice. Slices of printable ASCII are written as is,
+// unless they begin with "hex:". Any other slice is written as "hex:" followed by its bytes in hex.
+// These members are omitted if the Seq has none:
+//
+//	"minOffsets": [0, 16]
+//	"patterns":   [[], ["4d5a ?? 30-39"]]                               patterns for each Choice, as in ParsePattern
+//	"exclusions": [{"after": 0, "window": 30, "choice": ["mimetype"]}]
+//	"unordered":  [{"start": 1, "end": 3}]
+//	"counts":     [{"min": 1, "max": -1}, {"min": 0, "max": 1}]
+//	"gaps":       [{"min": 0, "max": -1}, {"min": 4, "max": 12}]
+//
+// The text form of a Seq is that produced by Seq.String, and the text form of a Choice is a bracketed,
+// | separated list of byte slices, e.g. [b | c | d]. In text, non-printable bytes are written as \xHH.
+
+type seqJSON struct {
+	MaxOffsets []int64     `json:"maxOffsets"`
+	MinOffsets []int64     `json:"minOffsets,omitempty"`
+	Choices    []Choice    `json:"choices"`
+	Patterns   [][]Pattern `json:"patterns,omitempty"`
+	Exclusions []Exclusion `json:"exclusions,omitempty"`
+	Unordered  []Group     `json:"unordered,omitempty"`
+	Counts     []Count     `json:"counts,omitempty"`
+	Gaps       []Gap       `json:"gaps,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Seq) MarshalJSON() ([]byte, error) {
+	return json.Marshal(seqJSON{s.MaxOffsets, s.MinOffsets, s.Choices, s.Patterns, s.Exclusions, s.Unordered, s.Counts, s.Gaps})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Seq) UnmarshalJSON(data []byte) error {
+	var sj seqJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return err
+	}
+	*s = Seq{MaxOffsets: sj.MaxOffsets, Choices: sj.Choices, MinOffsets: sj.MinOffsets, Patterns: sj.Patterns, Exclusions: sj.Exclusions, Unordered: sj.Unordered, Counts: sj.Counts, Gaps: sj.Gaps}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Seq) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Seq) UnmarshalText(text []byte) error {
+	seq, err := ParseSeq(string(text))
+	if err != nil {
+		return err
+	}
+	*s = seq
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Choice) MarshalJSON() ([]byte, error) {
+	return seqtext.MarshalChoice(c)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Choice) UnmarshalJSON(data []byte) error {
+	return seqtext.UnmarshalChoiceTo(c, data)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Choice) MarshalText() ([]byte, error) {
+	return []byte(seqtext.FormatChoice(c)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Choice) UnmarshalText(text []byte) error {
+	return seqtext.ParseChoiceTo(c, string(text))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Pattern) UnmarshalText(text []byte) error {
+	pat, err := ParsePattern(string(text))
+	if err != nil {
+		return err
+	}
+	*p = pat
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import "github.com/richardlehane/match/internal/seqtext"
+
+// ParseError reports the position, in bytes from the start of the input, of a problem parsing a Seq.
+type ParseError = seqtext.ParseError
+
+// ParseSeq parses the textual form of a Seq, as produced by Seq.String:
+//
+//	{Offsets: 5, -1; MinOffsets: 0, 2; Choices: [b | c | d], [ad]}
+//
+// The MinOffsets section is optional, as are these sections, which follow the Choices:
+//
+//	; Patterns: [], [61 30-39 ??]   patterns for each Choice, as in ParsePattern
+//	; Exclusions: 1+30 [x | y]      the index of the Choice each Exclusion follows, + its window, then its Choice
+//	; Unordered: 0:2                each Group, as start:end
+//	; Counts: 1..1, 0..3, 2..       each Count, as min..max, with max left out if it is -1
+//	; Gaps: 0.., 4..12              each Gap, as min..max, with max left out if it is -1
+//
+// Spaces between tokens are ignored, but are significant within the byte slices of a Choice,
+// except around the | separators. Within a Choice, \xHH is a byte in hex, \n, \r and \t are the usual
+// control characters, and a backslash escapes any other character (such as \| or \]).
+// For any valid Seq s, ParseSeq(s.String()) returns a Seq equal to s.
+// Errors are of type *ParseError.
+func ParseSeq(str string) (Seq, error) {
+	st, err := seqtext.Parse(str)
+	if err != nil {
+		return Seq{}, err
+	}
+	seq := Seq{MaxOffsets: st.Max, MinOffsets: st.Min}
+	for _, c := range st.Choices {
+		seq.Choices = append(seq.Choices, c)
+	}
+	if st.Patterns != nil {
+		seq.Patterns = make([][]Pattern, len(st.Patterns))
+		for i, ps := range st.Patterns {
+			for j, b := range ps {
+				p, pos, err := parsePattern(string(b))
+				if err != nil {
+					return Seq{}, &ParseError{Pos: st.PatternPos[i][j] + pos, Msg: err.Error()}
+				}
+				seq.Patterns[i] = append(seq.Patterns[i], p)
+			}
+		}
+	}
+	for _, c := range st.Counts {
+		seq.Counts = append(seq.Counts, Count{Min: int(c[0]), Max: int(c[1])})
+	}
+	for _, g := range st.Gaps {
+		seq.Gaps = append(seq.Gaps, Gap{Min: g[0], Max: g[1]})
+	}
+	for _, u := range st.Unordered {
+		seq.Unordered = append(seq.Unordered, Group{Start: u[0], End: u[1]})
+	}
+	for _, ex := range st.Exclusions {
+		seq.Exclusions = append(seq.Exclusions, Exclusion{After: ex.After, Window: ex.Window, Choice: ex.Choice})
+	}
+	return seq, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Scan is a handle on a running scan, started by IndexScan. Its results are received from Results, as for Index.
+type Scan struct {
+	Results chan Result
+	mu      sync.Mutex
+	retired []int // Seqs retired since the scan last took them
+	n       int32 // length of retired, read by the scan without the lock
+}
+
+// IndexScan is like IndexWith, but returns a handle on the scan, so that Seqs can be retired while it runs.
+// A nil mask enables all of the Seqs.
+func (wac *Wac) IndexScan(input io.ByteReader, mask SeqMask) *Scan {
+	if mask == nil {
+		mask = allSeqs(len(wac.bounds))
+	} else {
+		mask = append(SeqMask{}, mask...)
+	}
+	h := &Scan{Results: make(chan Result)}
+	go wac.match(input, h.Results, mask, h, progressResults(h.Results, nil), nil, true)
+	return h
+}
+
+// Retire stops the scan reporting any more results for the Seq at index seqIndex, e.g. once the client has
+// verified it, or ruled it out. Results that are already on their way may still be received.
+// Once every enabled Seq is retired, or the rest are exhausted, the scan stops without reading the rest of the input.
+// Retire is safe to call from any goroutine, and does nothing once the scan has stopped.
+func (h *Scan) Retire(seqIndex int) {
+	h.mu.Lock()
+	h.retired = append(h.retired, seqIndex)
+	atomic.StoreInt32(&h.n, int32(len(h.retired)))
+	h.mu.Unlock()
+}
+
+// pending reports whether any Seqs have been retired since the scan last took them
+func (h *Scan) pending() bool {
+	return atomic.LoadInt32(&h.n) > 0
+}
+
+// take removes the Seqs retired since the last call from the mask
+func (h *Scan) take(mask SeqMask) {
+	h.mu.Lock()
+	for _, i := range h.retired {
+		mask.Clear(i)
+	}
+	h.retired = h.retired[:0]
+	atomic.StoreInt32(&h.n, 0)
+	h.mu.Unlock()
+}
+
+// allSeqs returns a SeqMask with the first n Seqs set
+func allSeqs(n int) SeqMask {
+	m := make(SeqMask, (n+63)/64)
+	for i := 0; i < n; i++ {
+		m.Set(i)
+	}
+	return m
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+// SeqMask is a set of Seq indexes, one bit for each Seq, used to enable a subset of a Wac's Seqs for a scan (see IndexWith).
+type SeqMask []uint64
+
+// NewSeqMask returns a SeqMask with the given Seq indexes set.
+func NewSeqMask(idxs ...int) SeqMask {
+	var m SeqMask
+	for _, i := range idxs {
+		m.Set(i)
+	}
+	return m
+}
+
+// Set adds the Seq at index i to the mask.
+func (m *SeqMask) Set(i int) {
+	for len(*m) <= i/64 {
+		*m = append(*m, 0)
+	}
+	(*m)[i/64] |= 1 << uint(i%64)
+}
+
+// Clear removes the Seq at index i from the mask.
+func (m SeqMask) Clear(i int) {
+	if i >= 0 && i/64 < len(m) {
+		m[i/64] &^= 1 << uint(i%64)
+	}
+}
+
+// Has reports whether the Seq at index i is in the mask.
+func (m SeqMask) Has(i int) bool {
+	return i/64 < len(m) && m[i/64]&(1<<uint(i%64)) != 0
+}
+
+// bound returns the offset by which every match of the Seq, and any exclusion that follows it, must have ended,
+// or -1 if any of its Choices has a wildcard max offset
+func (s Seq) bound() int64 {
+	var bound int64
+	for i, max := range s.MaxOffsets {
+		if max < 0 {
+			return -1
+		}
+		var l int
+		for _, byts := range s.Choices[i] {
+			if len(byts) > l {
+				l = len(byts)
+			}
+		}
+		for _, p := range s.patterns(i) {
+			if len(p) > l {
+				l = len(p)
+			}
+		}
+		if end := max + int64(l) + s.hold(i); end > bound {
+			bound = end
+		}
+	}
+	return bound
+}
+
+// newBounds returns the bound of each Seq, and the offset by which they are all exhausted, or -1 if any is unbounded
+func newBounds(seqs []Seq) ([]int64, int64) {
+	bounds := make([]int64, len(seqs))
+	var end int64
+	for i, seq := range seqs {
+		bounds[i] = seq.bound()
+		if end >= 0 && (bounds[i] < 0 || bounds[i] > end) {
+			end = bounds[i]
+		}
+	}
+	return bounds, end
+}
+
+// limit returns the offset by which the Seqs enabled by the mask (or all of them, if it is nil) are exhausted,
+// or -1 if any of them is unbounded
+func (wac *Wac) limit(mask SeqMask) int64 {
+	if mask == nil {
+		return wac.end
+	}
+	var limit int64
+	for i, b := range wac.bounds {
+		if !mask.Has(i) {
+			continue
+		}
+		if b < 0 {
+			return -1
+		}
+		if b > limit {
+			limit = b
+		}
+	}
+	return limit
+}
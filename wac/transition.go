@@ -5,7 +5,8 @@ import "sort"
 type transitionFunc func() transition
 
 // transitions are defined as an interface.
-// This allows two implementations: a bloated but fast (trans), and a trim but a bit slower (transLM) version
+// This allows three implementations: a bloated but fast (trans), a trim but a bit slower (transLM) version,
+// and an adaptive version (transAdaptive) that is dense near the root, and trim deeper in the tree.
 type transition interface {
 	get(byte) *node
 	put(byte, transitionFunc) *node
@@ -105,3 +106,88 @@ func (t *transLM) iter(n int) *node {
 	}
 	return (*t)[n].n
 }
+
+// The adaptive transition is built as a slice of keys and nodes. When it is finalised, it is sorted and, if the node is
+// near the root or has many links, a dense array of 256 pointers is added. The nodes near the root are visited on most
+// bytes of the input, as fail links lead back to them, so they are as fast as trans. The many sparse nodes deeper in the tree
+// are small, like transLM.
+
+const (
+	denseDepth  = 1  // nodes at this depth, or nearer the root, are made dense
+	denseFanout = 16 // nodes with at least this many links are made dense
+)
+
+func newTransAdaptive() transition { return &transAdaptive{} }
+
+type transAdaptive struct {
+	depth int // depth of the node in the tree: the root is 0
+	keys  []byte
+	nodes []*node     // the nodes for each key. Nil once the transition is dense
+	gotos *[256]*node // nil unless the transition is dense
+}
+
+func (t *transAdaptive) Len() int {
+	return len(t.keys)
+}
+func (t *transAdaptive) Less(i, j int) bool {
+	return t.keys[i] < t.keys[j]
+}
+func (t *transAdaptive) Swap(i, j int) {
+	t.keys[i], t.keys[j] = t.keys[j], t.keys[i]
+	t.nodes[i], t.nodes[j] = t.nodes[j], t.nodes[i]
+}
+
+func (t *transAdaptive) put(b byte, fn transitionFunc) *node {
+	if n := t.get(b); n != nil {
+		return n
+	}
+	n := newNode(fn)
+	n.val = b
+	if a, ok := n.transit.(*transAdaptive); ok {
+		a.depth = t.depth + 1
+	}
+	t.keys = append(t.keys, b)
+	if t.gotos != nil {
+		t.gotos[b] = n
+	} else {
+		t.nodes = append(t.nodes, n)
+	}
+	return n
+}
+
+func (t *transAdaptive) get(b byte) *node {
+	if t.gotos != nil {
+		return t.gotos[b]
+	}
+	// sparse transitions have few keys, so a linear search is quicker than a binary search
+	for i, k := range t.keys {
+		if k == b {
+			return t.nodes[i]
+		}
+	}
+	return nil
+}
+
+func (t *transAdaptive) finalise() {
+	if t.gotos != nil {
+		return
+	}
+	sort.Sort(t)
+	if t.depth <= denseDepth || len(t.keys) >= denseFanout {
+		t.gotos = new([256]*node)
+		for i, k := range t.keys {
+			t.gotos[k] = t.nodes[i]
+		}
+		t.nodes = nil
+	}
+}
+
+func (t *transAdaptive) iter(n int) *node {
+	if n >= len(t.keys) {
+		return nil
+	}
+	if t.gotos != nil {
+		return t.gotos[t.keys[n]]
+	}
+	return t.nodes[n]
+}
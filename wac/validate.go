@@ -0,0 +1,126 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import "fmt"
+
+// SeqError describes a problem with a Seq.
+type SeqError struct {
+	Seq    int // index of the Seq, or -1 if not known
+	Choice int // index of the Choice, or -1 if the problem is with the Seq as a whole
+	Msg    string
+}
+
+func (e *SeqError) Error() string {
+	str := "wac: "
+	if e.Seq >= 0 {
+		str += fmt.Sprintf("seq %d: ", e.Seq)
+	}
+	if e.Choice >= 0 {
+		str += fmt.Sprintf("choice %d: ", e.Choice)
+	}
+	return str + e.Msg
+}
+
+// Validate checks that a Seq can be used to build a tree. It returns a *SeqError describing the first problem found.
+func (s Seq) Validate() error {
+	if len(s.Choices) == 0 {
+		return &SeqError{-1, -1, "no choices"}
+	}
+	if len(s.MaxOffsets) != len(s.Choices) {
+		return &SeqError{-1, -1, fmt.Sprintf("%d max offsets for %d choices", len(s.MaxOffsets), len(s.Choices))}
+	}
+	if len(s.MinOffsets) > len(s.Choices) {
+		return &SeqError{-1, -1, fmt.Sprintf("%d min offsets for %d choices", len(s.MinOffsets), len(s.Choices))}
+	}
+	if len(s.Counts) > len(s.Choices) {
+		return &SeqError{-1, -1, fmt.Sprintf("%d counts for %d choices", len(s.Counts), len(s.Choices))}
+	}
+	if len(s.Gaps) > len(s.Choices) {
+		return &SeqError{-1, -1, fmt.Sprintf("%d gaps for %d choices", len(s.Gaps), len(s.Choices))}
+	}
+	if s.Patterns != nil && len(s.Patterns) != len(s.Choices) {
+		return &SeqError{-1, -1, fmt.Sprintf("%d pattern lists for %d choices", len(s.Patterns), len(s.Choices))}
+	}
+	for i, choice := range s.Choices {
+		if len(choice) == 0 && len(s.patterns(i)) == 0 {
+			return &SeqError{-1, i, "empty choice"}
+		}
+		for j, p := range s.patterns(i) {
+			if msg := p.validate(); msg != "" {
+				return &SeqError{-1, i, fmt.Sprintf("pattern %d: %s", j, msg)}
+			}
+		}
+		for j, byts := range choice {
+			if len(byts) == 0 {
+				return &SeqError{-1, i, fmt.Sprintf("empty byte slice at alternative %d", j)}
+			}
+		}
+		if c := s.count(i); c.Min < 0 || c.Max < -1 || (c.Max > -1 && (c.Max == 0 || c.Max < c.Min)) {
+			return &SeqError{-1, i, fmt.Sprintf("invalid count %d..%d", c.Min, c.Max)}
+		}
+		if g := s.gap(i); g.Min < 0 || g.Max < -1 || (g.Max > -1 && g.Max < g.Min) {
+			return &SeqError{-1, i, fmt.Sprintf("invalid gap %d..%d", g.Min, g.Max)}
+		}
+		max, min := s.MaxOffsets[i], s.minOffset(i)
+		if max < -1 {
+			return &SeqError{-1, i, fmt.Sprintf("invalid max offset %d", max)}
+		}
+		if min < 0 {
+			return &SeqError{-1, i, fmt.Sprintf("invalid min offset %d", min)}
+		}
+		if max > -1 && min > max {
+			return &SeqError{-1, i, fmt.Sprintf("min offset %d is greater than max offset %d", min, max)}
+		}
+	}
+	for i, g := range s.Unordered {
+		if g.Start < 0 || g.End > len(s.Choices) || g.End-g.Start < 2 {
+			return &SeqError{-1, -1, fmt.Sprintf("invalid unordered group %d:%d", g.Start, g.End)}
+		}
+		for _, h := range s.Unordered[:i] {
+			if g.Start < h.End && h.Start < g.End {
+				return &SeqError{-1, -1, fmt.Sprintf("unordered group %d:%d overlaps group %d:%d", g.Start, g.End, h.Start, h.End)}
+			}
+		}
+	}
+	for i, ex := range s.Exclusions {
+		if ex.After < 0 || ex.After >= len(s.Choices) {
+			return &SeqError{-1, -1, fmt.Sprintf("exclusion %d follows choice %d, which doesn't exist", i, ex.After)}
+		}
+		if ex.Window < 0 {
+			return &SeqError{-1, ex.After, fmt.Sprintf("exclusion %d has invalid window %d", i, ex.Window)}
+		}
+		if len(ex.Choice) == 0 {
+			return &SeqError{-1, ex.After, fmt.Sprintf("exclusion %d is empty", i)}
+		}
+		for j, byts := range ex.Choice {
+			if len(byts) == 0 {
+				return &SeqError{-1, ex.After, fmt.Sprintf("exclusion %d: empty byte slice at alternative %d", i, j)}
+			}
+		}
+	}
+	return nil
+}
+
+// NewChecked validates the Seqs before creating a Wild Aho-Corasick tree. It returns a *SeqError for the first invalid Seq.
+func NewChecked(seqs []Seq) (*Wac, error) {
+	for i, seq := range seqs {
+		if err := seq.Validate(); err != nil {
+			err.(*SeqError).Seq = i
+			return nil, err
+		}
+	}
+	return New(seqs), nil
+}
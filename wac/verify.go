@@ -0,0 +1,107 @@
+// Copyright 2026 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wac
+
+import (
+	"io"
+	"sort"
+)
+
+// Verified is a Wild Aho-Corasick tree that reports complete Seq matches, rather than matches on sub-sequences.
+type Verified struct {
+	wac     *Wac
+	choices []int    // number of Choices in each Seq
+	last    [][2]int // the range of Choices, from and to inclusive, that complete each Seq: its last Choice, or the group that ends it
+}
+
+// SeqMatch reports a complete match of a Seq: every one of its Choices has matched, in order
+// (apart from the Choices in unordered groups, which can match in any order, and optional Choices, which can be skipped).
+type SeqMatch struct {
+	Index   int     // index of the Seq
+	Offsets []int64 // offset of the match for each Choice, or -1 for an optional Choice that was skipped
+	Lengths []int   // length of the match for each Choice, or 0 for an optional Choice that was skipped
+	Order   []int   // indexes of the Choices that matched, in the order they were observed in the input
+	Counts  []int   // number of matches counted for each Choice, at the time the Seq was reported
+}
+
+// NewVerified creates a Wild Aho-Corasick tree that tracks the progress of each Seq through its Choices.
+func NewVerified(seqs []Seq) *Verified {
+	choices := make([]int, len(seqs))
+	last := make([][2]int, len(seqs))
+	for i := range seqs {
+		choices[i] = len(seqs[i].Choices)
+		last[i][0], last[i][1] = seqs[i].before(choices[i])
+	}
+	return &Verified{New(seqs), choices, last}
+}
+
+// Index returns a channel of complete Seq matches. Each Seq is reported at most once, as soon as every Choice
+// has matched as many times as its Count requires. The offsets are those of the first match of each Choice that
+// followed the previous Choice (or, for an unordered group, the Choice before the group).
+func (v *Verified) Index(input io.ByteReader) chan SeqMatch {
+	output := make(chan SeqMatch)
+	go v.match(input, output)
+	return output
+}
+
+func (v *Verified) match(input io.ByteReader, results chan SeqMatch) {
+	precons := v.wac.p.get()
+	lengths := make([][]int, len(v.choices))
+	for i, l := range v.choices {
+		lengths[i] = make([]int, l)
+	}
+	reported := make([]bool, len(v.choices))
+	v.wac.scan(input, precons, nil, nil,
+		func(o out, offset int64, first bool) bool {
+			if first {
+				lengths[o.seqIndex][o.subIndex] = o.length
+			}
+			if reported[o.seqIndex] || !v.complete(precons, o.seqIndex, offset) {
+				return true
+			}
+			reported[o.seqIndex] = true
+			m := SeqMatch{
+				Index:   o.seqIndex,
+				Offsets: make([]int64, v.choices[o.seqIndex]),
+				Lengths: make([]int, v.choices[o.seqIndex]),
+				Counts:  make([]int, v.choices[o.seqIndex]),
+			}
+			for i, pc := range precons[o.seqIndex] {
+				m.Counts[i] = pc.count
+				if pc.first == 0 {
+					m.Offsets[i] = -1
+					continue
+				}
+				m.Lengths[i] = lengths[o.seqIndex][i]
+				m.Offsets[i] = pc.first - int64(m.Lengths[i])
+				m.Order = append(m.Order, i)
+			}
+			sort.SliceStable(m.Order, func(i, j int) bool { return m.Offsets[m.Order[i]] < m.Offsets[m.Order[j]] })
+			results <- m
+			return true
+		}, Progress{}, nil)
+	v.wac.p.put(precons)
+	close(results)
+}
+
+// complete reports whether every Choice that ends the Seq, the last Choice or all of a group that ends it, has been reached
+func (v *Verified) complete(precons precons, seq int, offset int64) bool {
+	for i := v.last[seq][0]; i <= v.last[seq][1]; i++ {
+		if !precons.reached(v.wac.steps[seq], seq, i, offset, anyGap) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package wac
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVerifiedTrailingGroup(t *testing.T) {
+	// the Seq ends with an unordered group, so it is only complete once both B and C have matched
+	seqs := []Seq{{
+		MaxOffsets: []int64{-1, -1, -1},
+		Choices:    []Choice{Choice{[]byte("A")}, Choice{[]byte("B")}, Choice{[]byte("C")}},
+		Unordered:  []Group{{1, 3}},
+	}}
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"A C", "[]"},
+		{"A C B", "[{0 [0 4 2] [1 1 1] [0 2 1] [1 1 1]}]"},
+	} {
+		results := []SeqMatch{}
+		for m := range NewVerified(seqs).Index(bytes.NewBufferString(c.input)) {
+			results = append(results, m)
+		}
+		if got := fmt.Sprint(results); got != c.expect {
+			t.Errorf("Verified fail for %q; Expecting: %s, Got: %s", c.input, c.expect, got)
+		}
+	}
+}
@@ -16,13 +16,16 @@
 //
 // This algorithm allows for sequences that are composed of sub-sequences
 // that can contain an arbitrary number of wildcards. Sequences can also be
-// given a maximum offset that defines the maximum byte position of the first sub-sequence.
+// given a maximum offset that defines the maximum byte position of the first sub-sequence,
+// and a minimum offset before which a sub-sequence is not matched.
 //
 // The results returned are for the matches on subsequences (NOT the full sequences).
 // The index of those subsequences and the offset is returned.
-// It is up to clients to verify that the complete sequence that they are interested in has matched.
+// It is up to clients to verify that the complete sequence that they are interested in has matched,
+// or they can use NewVerified to have complete Seq matches reported instead.
 // A "progress" result is sent from offset 1024 onwards. This is to update clients on scanning progress and has index -1,-1.
 // This result is sent on powers of two (1024, 2048, 4096, etc.)
+// Use IndexProgress to receive progress through a callback instead, at regular intervals, or not at all.
 
 // Example usage:
 //
@@ -47,54 +50,101 @@
 package wac
 
 import (
-	"fmt"
+	"context"
 	"io"
-	"strings"
+	"sync/atomic"
+
+	"github.com/richardlehane/match/internal/seqtext"
 )
 
 // Choice represents the different byte slices that can occur at each position of the Seq
 type Choice [][]byte
 
-// Seq is an ordered set of slices of Choices, with maximum offsets for each choice
+// Seq is an ordered set of slices of Choices, with maximum (and optionally minimum) offsets for each choice
 type Seq struct {
 	MaxOffsets []int64 // maximum offsets for each choice. Can be -1 for wildcard.
 	Choices    []Choice
+	MinOffsets []int64     // minimum offsets for each choice. Optional: if nil, or shorter than Choices, the minimum is 0.
+	Patterns   [][]Pattern // patterns for each choice, matched as further alternatives. Optional: if not nil, it has an entry for each choice.
+	Exclusions []Exclusion // negative choices that veto matches of the choices they follow. Optional.
+	Unordered  []Group     // runs of choices that can match in any order. Optional.
+	Counts     []Count     // the number of times each choice matches. Optional: if nil, or shorter than Choices, the count is 1 or more.
+	Gaps       []Gap       // the gap between each choice and the one before it. Optional: if nil, or shorter than Choices, the gap is 0 or more.
+}
+
+// minOffset returns the minimum offset for the Choice at index i
+func (s Seq) minOffset(i int) int64 {
+	if i < len(s.MinOffsets) {
+		return s.MinOffsets[i]
+	}
+	return 0
+}
+
+// patterns returns the patterns for the Choice at index i
+func (s Seq) patterns(i int) []Pattern {
+	if i < len(s.Patterns) {
+		return s.Patterns[i]
+	}
+	return nil
 }
 
 func (s Seq) String() string {
-	str := "{Offsets:"
-	for n, v := range s.MaxOffsets {
-		if n > 0 {
-			str += ","
-		}
-		str += fmt.Sprintf(" %d", v)
+	st := seqtext.Seq{Max: s.MaxOffsets, Min: s.MinOffsets, Choices: make([][][]byte, len(s.Choices))}
+	for i, c := range s.Choices {
+		st.Choices[i] = c
 	}
-	str += "; Choices:"
-	for n, v := range s.Choices {
-		if n > 0 {
-			str += ","
-		}
-		str += " ["
-		strs := make([]string, len(v))
-		for i := range v {
-			strs[i] = string(v[i])
+	if s.Patterns != nil {
+		st.Patterns = make([][][]byte, len(s.Patterns))
+		for i, ps := range s.Patterns {
+			st.Patterns[i] = make([][]byte, len(ps))
+			for j, p := range ps {
+				st.Patterns[i][j] = []byte(p.String())
+			}
 		}
-		str += strings.Join(strs, " | ")
-		str += "]"
 	}
-	return str + "}"
+	for _, c := range s.Counts {
+		st.Counts = append(st.Counts, [2]int64{int64(c.Min), int64(c.Max)})
+	}
+	for _, g := range s.Gaps {
+		st.Gaps = append(st.Gaps, [2]int64{g.Min, g.Max})
+	}
+	for _, g := range s.Unordered {
+		st.Unordered = append(st.Unordered, [2]int{g.Start, g.End})
+	}
+	for _, ex := range s.Exclusions {
+		st.Exclusions = append(st.Exclusions, seqtext.Exclusion{After: ex.After, Window: ex.Window, Choice: ex.Choice})
+	}
+	return seqtext.Format(st)
 }
 
-// New creates an Wild Aho-Corasick tree
+// New creates an Wild Aho-Corasick tree.
+// The zero tree, which is only visited at the start of the input, has adaptive transitions (see NewAdaptive),
+// and the main tree has fast transitions.
 func New(seqs []Seq) *Wac {
+	return newWac(seqs, newTransAdaptive, newTrans)
+}
+
+// NewAdaptive creates a Wild Aho-Corasick tree with adaptive transitions: nodes near the root, or with many links,
+// have fast transitions, and the rest have low memory transitions. It is nearly as fast as New, with much lower
+// memory requirements for large sets of Seqs.
+func NewAdaptive(seqs []Seq) *Wac {
+	return newWac(seqs, newTransAdaptive, newTransAdaptive)
+}
+
+// newWac creates a Wild Aho-Corasick tree with a zero tree and a main tree, using the given transitions for each
+func newWac(seqs []Seq, zfn, rfn transitionFunc) *Wac {
 	wac := new(Wac)
-	zero := newNode(newTrans)
-	zero.addGotos(seqs, true, newTrans) // TODO: cld use low memory here?
-	root := zero.addFails(true, newTrans)
-	root.addGotos(seqs, false, newTrans)
+	zero := newNode(zfn)
+	zero.addGotos(seqs, true, zfn, &wac.side)
+	root := zero.addFails(true, rfn)
+	root.addGotos(seqs, false, rfn, &wac.side)
 	root.addFails(false, nil)
 	wac.zero, wac.root = zero, root
 	wac.p = newPool(seqs)
+	wac.ring = ringSize(seqs)
+	wac.steps = newSteps(seqs)
+	wac.bounds, wac.end = newBounds(seqs)
+	wac.candidates = DefaultCandidates
 	return wac
 }
 
@@ -102,18 +152,63 @@ func New(seqs []Seq) *Wac {
 func NewLowMem(seqs []Seq) *Wac {
 	wac := new(Wac)
 	root := newNode(newTransLM)
-	root.addGotos(seqs, true, newTransLM)
+	root.addGotos(seqs, true, newTransLM, &wac.side)
 	root.addFails(false, nil)
 	wac.zero, wac.root = root, root
 	wac.p = newPool(seqs)
+	wac.ring = ringSize(seqs)
+	wac.steps = newSteps(seqs)
+	wac.bounds, wac.end = newBounds(seqs)
+	wac.candidates = DefaultCandidates
 	return wac
 }
 
 // Wac is a wild Aho-Corasick tree
 type Wac struct {
-	zero *node
-	root *node
-	p    *pool // pool of preconditions
+	zero       *node
+	root       *node
+	flat       *flat    // if not nil, the tree is flat, and zero and root are nil
+	p          *pool    // pool of preconditions
+	ring       int      // size of the buffer of recent input needed to verify anchored patterns, or 0 if there are none
+	steps      [][]step // how each Choice fits within its Seq
+	bounds     []int64  // offset by which each Seq is exhausted, or -1 if it is unbounded
+	end        int64    // offset by which every Seq is exhausted, or -1 if any is unbounded
+	candidates int32    // number of recent matches of each Choice kept as candidates for gaps. Accessed atomically.
+	side       lookaside
+}
+
+// DefaultCandidates is the number of recent matches of each Choice that a Wac keeps, as candidates
+// from which to measure the gap before the next Choice.
+const DefaultCandidates = 8
+
+// SetCandidates sets the number of recent matches of each Choice that are kept, as candidates from which
+// to measure the gap before the next Choice. With no candidates, gaps are only measured from the match that
+// first completed the Choice and the latest match that didn't overlap the one before it.
+// It is safe to call while scans are running: each scan keeps the number that was set when it started reading its input.
+func (wac *Wac) SetCandidates(n int) {
+	atomic.StoreInt32(&wac.candidates, int32(n))
+}
+
+// ringSize returns the smallest power of two that can hold the longest anchored pattern
+func ringSize(seqs []Seq) int {
+	var l int
+	for _, seq := range seqs {
+		for _, ps := range seq.Patterns {
+			for _, p := range ps {
+				if p.expansions() > maxExpand && len(p) > l {
+					l = len(p)
+				}
+			}
+		}
+	}
+	if l == 0 {
+		return 0
+	}
+	sz := 1
+	for sz < l {
+		sz <<= 1
+	}
+	return sz
 }
 
 type node struct {
@@ -129,16 +224,59 @@ func newNode(fn transitionFunc) *node { return &node{transit: fn()} }
 
 type out struct {
 	max      int64 // maximum offset at which can occur
+	min      int64 // minimum offset at which can occur
 	seqIndex int   // index within all the Seqs in the Wac
 	subIndex int   // index of the Choice within the Seq
+	alt      int   // index of the byte slice within the Choice, counting on into its patterns
 	length   int   // length of byte slice
+	check    int   // for anchored patterns, the index of the check in the lookaside plus one, or 0 if there is none
+	hold     int64 // for Choices with exclusions, how long matches are held back to check for them
+	excl     int   // for exclusions, the index of the Exclusion matched in the lookaside plus one, or 0 if there is none
+}
+
+// lookaside holds the checks and exclusions that outputs refer to by index, which keeps the outputs free of pointers
+type lookaside struct {
+	checks []check
+	excls  []Exclusion
+}
+
+func (l *lookaside) check(o out) *check { return &l.checks[o.check-1] }
+
+func (l *lookaside) excl(o out) *Exclusion { return &l.excls[o.excl-1] }
+
+// check is the part of an anchored pattern that is verified once its anchor matches.
+// The length of an out with a check is the distance from the start of the pattern to the end of the anchor.
+type check struct {
+	pattern Pattern
+}
+
+// matches verifies the pattern against the recent input held in ring, for a match ending at end
+func (c *check) matches(ring []byte, mask, end int64) bool {
+	start := end - int64(len(c.pattern))
+	for i, cl := range c.pattern {
+		if !cl.Contains(ring[(start+int64(i))&mask]) {
+			return false
+		}
+	}
+	return true
 }
 
+// pending is an anchored pattern waiting for the rest of its input, or a match held back while exclusions are checked
+type pending struct {
+	o      out
+	end    int64 // offset at the end of a held match
+	due    int64 // offset at which the pattern ends, or the hold is over
+	vetoed bool  // an exclusion has vetoed a held match
+}
+
+// contains reports whether the node already has the output, from any alternative of its Choice,
+// so that an alternative repeated within a Choice only matches once
 func (n *node) contains(o out) bool {
 	if n.output == nil {
 		return false
 	}
 	for _, o1 := range n.output {
+		o1.alt = o.alt
 		if o == o1 {
 			return true
 		}
@@ -162,24 +300,67 @@ func (n *node) addOutput(o out) {
 	n.output = append(n.output, o)
 }
 
-func (start *node) addGotos(seqs []Seq, zero bool, fn transitionFunc) {
+func (start *node) addGotos(seqs []Seq, zero bool, fn transitionFunc, side *lookaside) {
 	// iterate through byte sequences adding goto links to the link matrix
 	for id, seq := range seqs {
 		for i, choice := range seq.Choices {
-			// skip the first choice set if this isn't the zero tree and it is at 0 offset
-			if !zero && i == 0 && seq.MaxOffsets[0] == 0 {
-				continue
+			// skip the first choice set if this isn't the zero tree and it is at 0 offset, except for anchored patterns
+			// whose anchor doesn't start them: the scan has left the zero tree by the time it reaches such an anchor
+			skip := !zero && i == 0 && seq.MaxOffsets[0] == 0
+			o := out{max: seq.MaxOffsets[i], min: seq.minOffset(i), seqIndex: id, subIndex: i, hold: seq.hold(i)}
+			for j, byts := range choice {
+				if skip {
+					break
+				}
+				o.alt, o.length = j, len(byts)
+				if n := start.put(byts, fn); !n.contains(o) {
+					n.addOutput(o)
+				}
 			}
-			for _, byts := range choice {
+			for j, p := range seq.patterns(i) {
+				o.alt = len(choice) + j
+				if skip {
+					if s, _ := p.anchor(); s == 0 || p.expansions() <= maxExpand {
+						continue
+					}
+				}
+				if p.expansions() <= maxExpand {
+					for _, byts := range p.expand() {
+						o.length = len(byts)
+						if n := start.put(byts, fn); !n.contains(o) {
+							n.addOutput(o)
+						}
+					}
+					continue
+				}
+				// put the anchor in the tree, and verify the rest of the pattern when it matches
+				s, e := p.anchor()
 				curr := start
-				for _, byt := range byts {
-					curr = curr.transit.put(byt, fn)
+				for _, c := range p[s:e] {
+					curr = curr.transit.put(c.members()[0], fn)
 				}
-				max := seq.MaxOffsets[i]
-				curr.addOutput(out{max, id, i, len(byts)})
+				a := o
+				side.checks = append(side.checks, check{p})
+				a.length, a.check = e, len(side.checks)
+				curr.addOutput(a)
 			}
 		}
+		for _, ex := range seq.Exclusions {
+			side.excls = append(side.excls, ex)
+			for j, byts := range ex.Choice {
+				start.put(byts, fn).addOutput(out{max: -1, seqIndex: id, subIndex: ex.After, alt: j, length: len(byts), excl: len(side.excls)})
+			}
+		}
+	}
+}
+
+// put adds goto links for the byte slice, and returns the node at its end
+func (start *node) put(byts []byte, fn transitionFunc) *node {
+	curr := start
+	for _, byt := range byts {
+		curr = curr.transit.put(byt, fn)
 	}
+	return curr
 }
 
 func (start *node) addFails(zero bool, tfn transitionFunc) *node {
@@ -253,12 +434,21 @@ func (start *node) addFails(zero bool, tfn transitionFunc) *node {
 
 // preconditions ensure that subsequent (>0) Choices in a Seq are only sent when previous Choices have already matched
 // previous matches are stored as offsets to prevent overlapping matches resulting in false positives
-type precons [][]int64
+type precons [][]precon
+
+// precon records the matches of a Choice, as offsets at the end of the match
+type precon struct {
+	first int64   // the first match, or 0 if there is none
+	last  int64   // the latest match counted: repetitions can't overlap it
+	done  int64   // the match that brought the count up to the Choice's minimum, or 0 if there is none
+	count int     // number of matches counted
+	ends  []int64 // the most recent matches, as candidates for measuring gaps from
+}
 
 func newPrecons(t []int) precons {
-	p := make([][]int64, len(t))
+	p := make([][]precon, len(t))
 	for i, v := range t {
-		p[i] = make([]int64, v)
+		p[i] = make([]precon, v)
 	}
 	return p
 }
@@ -266,7 +456,7 @@ func newPrecons(t []int) precons {
 func clear(p precons) precons {
 	for i := range p {
 		for j := range p[i] {
-			p[i][j] = 0
+			p[i][j] = precon{ends: p[i][j].ends[:0]}
 		}
 	}
 	return p
@@ -274,55 +464,365 @@ func clear(p precons) precons {
 
 // Index returns a channel of results, these contain the indexes (a double index: index of the Seq and index of the Choice)
 // and offsets (in the input byte slice) of matching sequences.
+// Progress results, with index -1,-1, are sent at powers of two from offset 1024.
+// The scan stops at the end of the input, or as soon as every Seq is past its max offsets (if none has a wildcard).
+// To learn why it stopped, use IndexWith with a nil mask.
 func (wac *Wac) Index(input io.ByteReader) chan Result {
 	output := make(chan Result)
-	go wac.match(input, output)
+	go wac.match(input, output, nil, nil, progressResults(output, nil), nil, false)
 	return output
 }
 
+// IndexWith is like Index, but only the Seqs in the mask are matched: results for the others aren't reported.
+// The scan ends early, without reading the rest of the input, once every enabled Seq is past its max offsets.
+// A nil mask enables all of the Seqs. The mask is copied, so the caller can change it once IndexWith returns.
+// The final result, also with index -1,-1, reports why the scan stopped (see Stop).
+func (wac *Wac) IndexWith(input io.ByteReader, mask SeqMask) chan Result {
+	if mask == nil {
+		mask = allSeqs(len(wac.bounds))
+	} else {
+		mask = append(SeqMask{}, mask...)
+	}
+	output := make(chan Result)
+	go wac.match(input, output, mask, nil, progressResults(output, nil), nil, true)
+	return output
+}
+
+// IndexProgress is like Index, but progress is reported through p rather than as results with index -1,-1.
+// A zero Progress turns progress reporting off.
+func (wac *Wac) IndexProgress(input io.ByteReader, p Progress) chan Result {
+	output := make(chan Result)
+	go wac.match(input, output, nil, nil, p, nil, false)
+	return output
+}
+
+// IndexContext is like Index, but scanning stops as soon as the context is done.
+// No more input is read and the results channel is closed, so clients can stop receiving once they have what they need.
+func (wac *Wac) IndexContext(ctx context.Context, input io.ByteReader) chan Result {
+	output := make(chan Result)
+	go wac.match(input, output, nil, nil, progressResults(output, ctx.Done()), ctx.Done(), false)
+	return output
+}
+
+// progressResults sends progress results, with index -1,-1, at powers of two
+func progressResults(output chan Result, done <-chan struct{}) Progress {
+	progressResult := Result{Index: [2]int{-1, -1}}
+	return Progress{Report: func(offset int64) {
+		progressResult.Offset = offset
+		select {
+		case output <- progressResult:
+		case <-done:
+		}
+	}}
+}
+
 // Result contains the index and offset of matches.
 type Result struct {
 	Index  [2]int // a double index: index of the Seq and index of the Choice
 	Offset int64
 	Length int
+	Alt    int  // index of the byte slice within the Choice that matched. Patterns are counted on from the byte slices.
+	Stop   Stop // why the scan stopped: only set on the final result of a scan by IndexWith or IndexScan, which has index -1,-1
 }
 
-func (wac *Wac) match(input io.ByteReader, results chan Result) {
-	var offset int64
-	var progressResult = Result{Index: [2]int{-1, -1}}
+// Stop is the reason a scan stopped, as reported by the final result of IndexWith and IndexScan.
+type Stop int
+
+const (
+	Scanning   Stop = iota // the scan hasn't stopped: this is a match or a progress result
+	EndOfInput             // the input was read to its end
+	ReadError              // the input couldn't be read
+	Exhausted              // every Seq was past its max offsets, so the rest of the input wasn't read
+	Cancelled              // the scan was cancelled. It is never reported: only IndexContext scans can be cancelled, and they send no final result
+	Retired                // every enabled Seq was retired (see Scan.Retire), so the rest of the input wasn't read
+)
+
+func (s Stop) String() string {
+	switch s {
+	case Scanning:
+		return "scanning"
+	case EndOfInput:
+		return "end of input"
+	case ReadError:
+		return "read error"
+	case Exhausted:
+		return "exhausted"
+	case Cancelled:
+		return "cancelled"
+	case Retired:
+		return "retired"
+	}
+	return "unknown"
+}
+
+// Progress configures the reporting of scanning progress.
+type Progress struct {
+	Every  int64              // report every Every bytes. If zero, report at powers of two from 1024 (1024, 2048, 4096, etc.)
+	Report func(offset int64) // called, from the scanning goroutine, with the number of bytes scanned. If nil, progress isn't reported.
+}
+
+// first returns the first offset to report at, or -1 if progress is off
+func (p Progress) first() int64 {
+	switch {
+	case p.Report == nil:
+		return -1
+	case p.Every > 0:
+		return p.Every
+	}
+	return 1024
+}
+
+func (p Progress) next(offset int64) int64 {
+	if p.Every > 0 {
+		return offset + p.Every
+	}
+	return offset * 2
+}
+
+// match sends the results of a scan, then, if final is true and the scan wasn't cancelled, a result that reports why it stopped
+func (wac *Wac) match(input io.ByteReader, results chan Result, mask SeqMask, h *Scan, progress Progress, done <-chan struct{}, final bool) {
 	precons := wac.p.get()
-	curr := wac.zero
-	for c, err := input.ReadByte(); err == nil; c, err = input.ReadByte() {
+	offset, stop := wac.scan(input, precons, mask, h,
+		func(o out, offset int64, first bool) bool {
+			select {
+			case results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length, Alt: o.alt}:
+				return true
+			case <-done:
+				return false
+			}
+		}, progress, done)
+	wac.p.put(precons)
+	if final && stop != Cancelled {
+		select {
+		case results <- Result{Index: [2]int{-1, -1}, Offset: offset, Stop: stop}:
+		case <-done:
+		}
+	}
+	close(results)
+}
+
+// scan runs the input through the tree. The hit function is called for every Choice whose preconditions are met,
+// with the offset at the end of the match. First is true if this is the first match recorded in the precons for that Choice.
+// If the mask isn't nil, only the Seqs it enables are matched. If there is a handle, the Seqs retired through it
+// are removed from the mask as the scan goes. The scan stops once every enabled Seq is exhausted or retired.
+// It is cancelled if hit returns false, or if done is closed. Progress is reported as configured.
+// It returns the number of bytes read, and why it stopped.
+func (wac *Wac) scan(input io.ByteReader, precons precons, mask SeqMask, h *Scan, hit func(o out, offset int64, first bool) bool, progress Progress, done <-chan struct{}) (int64, Stop) {
+	var offset int64
+	limit := wac.limit(mask)
+	if limit == 0 {
+		return offset, Exhausted
+	}
+	stop := Exhausted
+	report := progress.first()
+	curr, fcurr := wac.zero, int32(0)
+	if wac.flat != nil {
+		fcurr = wac.flat.zero
+	}
+	s := scanner{precons: precons, steps: wac.steps, candidates: int(atomic.LoadInt32(&wac.candidates)), hit: hit, enabled: mask, side: &wac.side}
+	if wac.ring > 0 {
+		s.ring = make([]byte, wac.ring)
+		s.mask = int64(wac.ring - 1)
+	}
+	var c byte
+	var err error
+	for c, err = input.ReadByte(); err == nil; c, err = input.ReadByte() {
+		if done != nil {
+			select {
+			case <-done:
+				return offset, Cancelled
+			default:
+			}
+		}
+		if h != nil && h.pending() {
+			h.take(mask)
+			if limit = wac.limit(mask); limit == 0 {
+				stop = Retired
+				break
+			}
+		}
+		if s.ring != nil {
+			s.ring[offset&s.mask] = c
+		}
 		offset++
-		if trans := curr.transit.get(c); trans != nil {
-			curr = trans
+		var output []out
+		var outMax int64
+		var outMaxL int
+		if f := wac.flat; f != nil {
+			fcurr = f.next(fcurr, c)
+			output, outMax, outMaxL = f.output(fcurr)
 		} else {
-			for curr != wac.root {
-				curr = curr.fail
-				if trans := curr.transit.get(c); trans != nil {
-					curr = trans
-					break
-				}
+			if trans := curr.transit.get(c); trans != nil {
+				curr = trans
+			} else {
+				for curr != wac.root {
+					curr = curr.fail
+					if trans := curr.transit.get(c); trans != nil {
+						curr = trans
+						break
+					}
 
+				}
 			}
+			output, outMax, outMaxL = curr.output, curr.outMax, curr.outMaxL
 		}
-		if curr.output != nil && (curr.outMax == -1 || curr.outMax >= offset-int64(curr.outMaxL)) {
-			for _, o := range curr.output {
-				if o.max == -1 || o.max >= offset-int64(o.length) {
-					if o.subIndex == 0 || (precons[o.seqIndex][o.subIndex-1] != 0 && offset-int64(o.length) >= precons[o.seqIndex][o.subIndex-1]) {
-						if precons[o.seqIndex][o.subIndex] == 0 {
-							precons[o.seqIndex][o.subIndex] = offset
+		if output != nil && (outMax == -1 || outMax >= offset-int64(outMaxL)) {
+			for _, o := range output {
+				if mask != nil && !mask.Has(o.seqIndex) {
+					continue
+				}
+				if (o.max == -1 || o.max >= offset-int64(o.length)) && offset-int64(o.length) >= o.min {
+					switch {
+					case o.excl != 0:
+						s.veto(o, offset)
+					case o.check != 0:
+						s.queue = append(s.queue, pending{o: o, due: offset + int64(len(s.side.check(o).pattern)-o.length)})
+					default:
+						if !s.emit(o, offset) {
+							return offset, Cancelled
 						}
-						results <- Result{Index: [2]int{o.seqIndex, o.subIndex}, Offset: offset - int64(o.length), Length: o.length}
 					}
 				}
 			}
 		}
-		if offset&(^offset+1) == offset && offset >= 1024 { // send powers of 2 greater than 512
-			progressResult.Offset = offset
-			results <- progressResult
+		if len(s.queue) > 0 && !s.release(offset) {
+			return offset, Cancelled
+		}
+		if offset == report {
+			progress.Report(offset)
+			report = progress.next(offset)
+		}
+		if limit >= 0 && offset >= limit {
+			break
 		}
 	}
-	wac.p.put(precons)
-	close(results)
+	if !s.flush() {
+		return offset, Cancelled
+	}
+	switch {
+	case err == nil:
+		return offset, stop
+	case err != io.EOF:
+		return offset, ReadError
+	}
+	return offset, EndOfInput
+}
+
+// scanner holds the preconditions of a scan, along with the recent input, if the tree has anchored patterns,
+// and the patterns and held matches that are pending.
+type scanner struct {
+	precons      precons
+	steps        [][]step
+	candidates   int
+	hit          func(o out, offset int64, first bool) bool
+	enabled      SeqMask // the Seqs that are matched, or nil for all
+	side         *lookaside
+	ring         []byte
+	mask         int64
+	queue, ready []pending
+}
+
+// met reports whether the preconditions for a match ending at offset are met
+func (s *scanner) met(o out, offset int64) bool {
+	return s.precons.met(s.steps[o.seqIndex], o.seqIndex, o.subIndex, offset-int64(o.length))
+}
+
+// try records and reports a match, if its preconditions are met
+func (s *scanner) try(o out, offset int64) bool {
+	if (s.enabled != nil && !s.enabled.Has(o.seqIndex)) || !s.met(o, offset) {
+		return true
+	}
+	if send, first := s.precons.record(s.steps[o.seqIndex][o.subIndex], o.seqIndex, o.subIndex, offset, o.length, s.candidates); send {
+		return s.hit(o, offset, first)
+	}
+	return true
+}
+
+// blocked returns when the hold on a match of a preceding Choice, that could meet the preconditions of a match ending at offset,
+// is over, or 0 if there is none
+func (s *scanner) blocked(o out, offset int64) int64 {
+	var due int64
+	if s.met(o, offset) {
+		return due
+	}
+	for _, p := range s.queue {
+		if p.o.check == 0 && !p.vetoed && p.o.seqIndex == o.seqIndex && p.o.subIndex < o.subIndex && p.end <= offset-int64(o.length) && p.due > due {
+			due = p.due
+		}
+	}
+	return due
+}
+
+// emit holds back matches of Choices with exclusions, and matches that depend on them, and tries the rest
+func (s *scanner) emit(o out, offset int64) bool {
+	if o.hold > 0 {
+		s.queue = append(s.queue, pending{o: o, end: offset, due: offset + o.hold})
+		return true
+	}
+	if len(s.queue) > 0 {
+		if due := s.blocked(o, offset); due > 0 {
+			s.queue = append(s.queue, pending{o: o, end: offset, due: due})
+			return true
+		}
+	}
+	return s.try(o, offset)
+}
+
+// veto marks the held matches that an exclusion, ending at offset, follows within its window
+func (s *scanner) veto(o out, offset int64) {
+	start, ex := offset-int64(o.length), s.side.excl(o)
+	for i := range s.queue {
+		p := &s.queue[i]
+		if p.o.check == 0 && p.o.seqIndex == o.seqIndex && p.o.subIndex == ex.After && start >= p.end && start <= p.end+ex.Window {
+			p.vetoed = true
+		}
+	}
+}
+
+// release verifies the patterns, and tries the held matches, that are due at offset
+func (s *scanner) release(offset int64) bool {
+	// take what is due out of the queue first, as it may be added to while the ready matches are tried
+	n := 0
+	s.ready = s.ready[:0]
+	for _, p := range s.queue {
+		if p.due == offset {
+			s.ready = append(s.ready, p)
+		} else {
+			s.queue[n] = p
+			n++
+		}
+	}
+	s.queue = s.queue[:n]
+	for _, p := range s.ready {
+		switch {
+		case p.vetoed:
+		case p.o.check != 0:
+			if c := s.side.check(p.o); c.matches(s.ring, s.mask, offset) {
+				o := p.o
+				o.length = len(c.pattern)
+				if !s.emit(o, offset) {
+					return false
+				}
+			}
+		default:
+			if due := s.blocked(p.o, p.end); due > 0 {
+				s.queue = append(s.queue, pending{o: p.o, end: p.end, due: due})
+			} else if !s.try(p.o, p.end) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// flush tries the matches still held back at the end of the input, as they can't be vetoed any more
+func (s *scanner) flush() bool {
+	for _, p := range s.queue {
+		if p.o.check == 0 && !p.vetoed {
+			if !s.try(p.o, p.end) {
+				return false
+			}
+		}
+	}
+	return true
 }
@@ -1,8 +1,18 @@
 package wac
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
 	"testing"
+	"testing/iotest"
 )
 
 func equal(a []Result, b []Result) bool {
@@ -17,9 +27,13 @@ func equal(a []Result, b []Result) bool {
 	return true
 }
 
+// loop collects the results of a scan, apart from the final result
 func loop(output chan Result) []Result {
 	results := make([]Result, 0)
 	for res := range output {
+		if res.Stop != Scanning {
+			continue
+		}
 		results = append(results, res)
 	}
 	return results
@@ -38,17 +52,29 @@ func test(t *testing.T, a []byte, b []Seq, expect []Result) {
 	if !equal(expect, results) {
 		t.Errorf("Index fail for Low Mem; Expecting: %v, Got: %v", expect, results)
 	}
+	wac3 := NewAdaptive(b)
+	output = wac3.Index(bytes.NewBuffer(a))
+	results = loop(output)
+	if !equal(expect, results) {
+		t.Errorf("Index fail for Adaptive; Expecting: %v, Got: %v", expect, results)
+	}
+	wac4 := NewFlat(b)
+	output = wac4.Index(bytes.NewBuffer(a))
+	results = loop(output)
+	if !equal(expect, results) {
+		t.Errorf("Index fail for Flat; Expecting: %v, Got: %v", expect, results)
+	}
 }
 
 func seq(s string) Seq {
-	return Seq{[]int64{-1}, []Choice{Choice{[]byte(s)}}}
+	return Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte(s)}}}
 }
 
 // Tests (the test strings are taken from John Graham-Cumming's lua implementation: https://github.com/jgrahamc/aho-corasick-lua Copyright (c) 2013 CloudFlare)
 func TestWikipedia(t *testing.T) {
 	test(t, []byte("abccab"),
 		[]Seq{seq("a"), seq("ab"), seq("bc"), seq("bca"), seq("c"), seq("caa")},
-		[]Result{Result{[2]int{0, 0}, 0, 1}, Result{[2]int{1, 0}, 0, 2}, Result{[2]int{2, 0}, 1, 2}, Result{[2]int{4, 0}, 2, 1}, Result{[2]int{4, 0}, 3, 1}, Result{[2]int{0, 0}, 4, 1}, Result{[2]int{1, 0}, 4, 2}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 0, Length: 2}, Result{Index: [2]int{2, 0}, Offset: 1, Length: 2}, Result{Index: [2]int{4, 0}, Offset: 2, Length: 1}, Result{Index: [2]int{4, 0}, Offset: 3, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 4, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 4, Length: 2}})
 }
 
 func TestSimple(t *testing.T) {
@@ -56,129 +82,686 @@ func TestSimple(t *testing.T) {
 		[]Seq{seq("poto")},
 		[]Result{})
 	test(t, []byte("The pot had a handle The"),
-		[]Seq{Seq{[]int64{0}, []Choice{Choice{[]byte("The")}}}},
-		[]Result{Result{[2]int{0, 0}, 0, 3}})
+		[]Seq{Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("The")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot ")},
-		[]Result{Result{[2]int{0, 0}, 4, 4}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ot h")},
-		[]Result{Result{[2]int{0, 0}, 5, 4}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("andle")},
-		[]Result{Result{[2]int{0, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 15, Length: 5}})
 }
 
 func TestMultipleNonoverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("h")},
-		[]Result{Result{[2]int{0, 0}, 1, 1}, Result{[2]int{0, 0}, 8, 1}, Result{[2]int{0, 0}, 14, 1}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 1, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("ha"), seq("he")},
-		[]Result{Result{[2]int{1, 0}, 1, 2}, Result{[2]int{0, 0}, 8, 2}, Result{[2]int{0, 0}, 14, 2}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 1, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 2}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}, Result{[2]int{1, 0}, 8, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("pot"), seq("had"), seq("hod")},
-		[]Result{Result{[2]int{0, 0}, 4, 3}, Result{[2]int{1, 0}, 8, 3}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 8, Length: 3}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("The"), seq("pot"), seq("had"), seq("hod"), seq("andle")},
-		[]Result{Result{[2]int{0, 0}, 0, 3}, Result{[2]int{1, 0}, 4, 3}, Result{[2]int{2, 0}, 8, 3}, Result{[2]int{4, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 8, Length: 3}, Result{Index: [2]int{4, 0}, Offset: 15, Length: 5}})
 }
 
 func TestOverlapping(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("Th"), seq("he pot"), seq("The"), seq("pot h")},
-		[]Result{Result{[2]int{0, 0}, 0, 2}, Result{[2]int{2, 0}, 0, 3}, Result{[2]int{1, 0}, 1, 6}, Result{[2]int{3, 0}, 4, 5}})
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 2}, Result{Index: [2]int{2, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{1, 0}, Offset: 1, Length: 6}, Result{Index: [2]int{3, 0}, Offset: 4, Length: 5}})
 }
 
 func TestNesting(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("and"), seq("andle")},
-		[]Result{Result{[2]int{1, 0}, 14, 4}, Result{[2]int{2, 0}, 15, 3}, Result{[2]int{0, 0}, 14, 6}, Result{[2]int{3, 0}, 15, 5}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{2, 0}, Offset: 15, Length: 3}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}, Result{Index: [2]int{3, 0}, Offset: 15, Length: 5}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("hand"), seq("an"), seq("n")},
-		[]Result{Result{[2]int{2, 0}, 15, 2}, Result{[2]int{3, 0}, 16, 1}, Result{[2]int{1, 0}, 14, 4}, Result{[2]int{0, 0}, 14, 6}})
+		[]Result{Result{Index: [2]int{2, 0}, Offset: 15, Length: 2}, Result{Index: [2]int{3, 0}, Offset: 16, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dle"), seq("l"), seq("le")},
-		[]Result{Result{[2]int{1, 0}, 18, 1}, Result{[2]int{0, 0}, 17, 3}, Result{[2]int{2, 0}, 18, 2}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 17, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 18, Length: 2}})
 }
 
 func TestRandom(t *testing.T) {
 	test(t, []byte("yasherhs"),
 		[]Seq{seq("say"), seq("she"), seq("shr"), seq("he"), seq("her")},
-		[]Result{Result{[2]int{1, 0}, 2, 3}, Result{[2]int{3, 0}, 3, 2}, Result{[2]int{4, 0}, 3, 3}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 2, Length: 3}, Result{Index: [2]int{3, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{4, 0}, Offset: 3, Length: 3}})
 }
 
 func TestFailPartial(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("dlf"), seq("l")},
-		[]Result{Result{[2]int{1, 0}, 18, 1}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
 }
 
 func TestMany(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("andle"), seq("ndle"), seq("dle"), seq("le"), seq("e")},
-		[]Result{Result{[2]int{5, 0}, 2, 1}, Result{[2]int{0, 0}, 14, 6}, Result{[2]int{1, 0}, 15, 5}, Result{[2]int{2, 0}, 16, 4}, Result{[2]int{3, 0}, 17, 3}, Result{[2]int{4, 0}, 18, 2}, Result{[2]int{5, 0}, 19, 1}})
+		[]Result{Result{Index: [2]int{5, 0}, Offset: 2, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}, Result{Index: [2]int{1, 0}, Offset: 15, Length: 5}, Result{Index: [2]int{2, 0}, Offset: 16, Length: 4}, Result{Index: [2]int{3, 0}, Offset: 17, Length: 3}, Result{Index: [2]int{4, 0}, Offset: 18, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 19, Length: 1}})
 	test(t, []byte("The pot had a handle"),
 		[]Seq{seq("handle"), seq("handl"), seq("hand"), seq("han"), seq("ha"), seq("a")},
-		[]Result{Result{[2]int{4, 0}, 8, 2}, Result{[2]int{5, 0}, 9, 1}, Result{[2]int{5, 0}, 12, 1}, Result{[2]int{4, 0}, 14, 2}, Result{[2]int{5, 0}, 15, 1}, Result{[2]int{3, 0}, 14, 3}, Result{[2]int{2, 0}, 14, 4}, Result{[2]int{1, 0}, 14, 5}, Result{[2]int{0, 0}, 14, 6}})
+		[]Result{Result{Index: [2]int{4, 0}, Offset: 8, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 9, Length: 1}, Result{Index: [2]int{5, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{4, 0}, Offset: 14, Length: 2}, Result{Index: [2]int{5, 0}, Offset: 15, Length: 1}, Result{Index: [2]int{3, 0}, Offset: 14, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 14, Length: 4}, Result{Index: [2]int{1, 0}, Offset: 14, Length: 5}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 6}})
 }
 
 func TestLong(t *testing.T) {
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in")},
-		[]Result{Result{[2]int{1, 0}, 3, 2}, Result{[2]int{0, 0}, 1, 8}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("in"), seq("tosh")},
-		[]Result{Result{[2]int{1, 0}, 3, 2}, Result{[2]int{0, 0}, 1, 8}, Result{[2]int{2, 0}, 5, 4}})
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}, Result{Index: [2]int{2, 0}, Offset: 5, Length: 4}})
 	test(t, []byte("macintosh"),
 		[]Seq{seq("acintosh"), seq("into"), seq("to"), seq("in")},
-		[]Result{Result{[2]int{3, 0}, 3, 2}, Result{[2]int{1, 0}, 3, 4}, Result{[2]int{2, 0}, 5, 2}, Result{[2]int{0, 0}, 1, 8}})
+		[]Result{Result{Index: [2]int{3, 0}, Offset: 3, Length: 2}, Result{Index: [2]int{1, 0}, Offset: 3, Length: 4}, Result{Index: [2]int{2, 0}, Offset: 5, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 1, Length: 8}})
 }
 
 func TestOffset(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
-		[]Seq{Seq{[]int64{0}, []Choice{Choice{[]byte("pot")}}}, Seq{[]int64{18}, []Choice{Choice{[]byte("l")}}}},
-		[]Result{Result{[2]int{1, 0}, 18, 1}})
+		[]Seq{Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("pot")}}}, Seq{MaxOffsets: []int64{18}, Choices: []Choice{Choice{[]byte("l")}}}},
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 18, Length: 1}})
+}
+
+func TestMinOffset(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("h")}}, MinOffsets: []int64{5}}, Seq{MaxOffsets: []int64{13}, Choices: []Choice{Choice{[]byte("a")}}, MinOffsets: []int64{10}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 8, Length: 1}, Result{Index: [2]int{1, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 1}})
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("h")}}, MinOffsets: []int64{0, 10}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{0, 1}, Offset: 14, Length: 1}})
 }
 
 func TestChoices(t *testing.T) {
 	test(t, []byte("The pot had a handle"),
 		[]Seq{
-			Seq{[]int64{0, 18, -1}, []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}, Choice{[]byte("l")}}},
-			Seq{[]int64{-1}, []Choice{Choice{[]byte("The")}}},
-			Seq{[]int64{8, -1}, []Choice{Choice{[]byte("had")}, Choice{[]byte("ndle")}}},
+			Seq{MaxOffsets: []int64{0, 18, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}, Choice{[]byte("l")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("The")}}},
+			Seq{MaxOffsets: []int64{8, -1}, Choices: []Choice{Choice{[]byte("had")}, Choice{[]byte("ndle")}}},
 		},
 		[]Result{
-			Result{[2]int{0, 0}, 0, 3},
-			Result{[2]int{1, 0}, 0, 3},
-			Result{[2]int{0, 1}, 4, 3},
-			Result{[2]int{2, 0}, 8, 3},
-			Result{[2]int{0, 2}, 18, 1},
-			Result{[2]int{2, 1}, 16, 4},
+			Result{Index: [2]int{0, 0}, Offset: 0, Length: 3},
+			Result{Index: [2]int{1, 0}, Offset: 0, Length: 3},
+			Result{Index: [2]int{0, 1}, Offset: 4, Length: 3},
+			Result{Index: [2]int{2, 0}, Offset: 8, Length: 3},
+			Result{Index: [2]int{0, 2}, Offset: 18, Length: 1},
+			Result{Index: [2]int{2, 1}, Offset: 16, Length: 4},
 		})
 }
 
+func TestAlt(t *testing.T) {
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("xyz"), []byte("pot"), []byte("had")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 3, Alt: 1}, Result{Index: [2]int{0, 0}, Offset: 8, Length: 3, Alt: 2}})
+	// an alternative that is repeated only matches once, as the first of its copies
+	test(t, []byte("The pot had a handle"),
+		[]Seq{Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("a"), []byte("a"), []byte("ha")}}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 8, Length: 2, Alt: 2}, Result{Index: [2]int{0, 0}, Offset: 9, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 12, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 14, Length: 2, Alt: 2}, Result{Index: [2]int{0, 0}, Offset: 15, Length: 1}})
+}
+
+func TestPatterns(t *testing.T) {
+	pat := func(s string) Pattern {
+		p, err := ParsePattern(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	test(t, []byte("xxMZ\x01\x02PyyMZ\x01\x02Q PK\x00\x00\x03\x04 a7"),
+		[]Seq{
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{nil}, Patterns: [][]Pattern{{pat("4d5a ?? ?? !51")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("zz")}}, Patterns: [][]Pattern{{pat("504b ?? ?? 0304")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{nil}, Patterns: [][]Pattern{{pat("61 30-39")}}},
+		},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 2, Length: 5}, Result{Index: [2]int{1, 0}, Offset: 15, Length: 6, Alt: 1}, Result{Index: [2]int{2, 0}, Offset: 22, Length: 2}})
+	// anchored patterns respect offsets and preconditions, measured from the start of the pattern
+	test(t, []byte("MZ\x00\x00PE MZ\x01\x00PE"),
+		[]Seq{Seq{MaxOffsets: []int64{6, -1}, Choices: []Choice{nil, Choice{[]byte("E")}}, Patterns: [][]Pattern{{pat("4d5a ?? ?? 50")}, nil}}},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 5}, Result{Index: [2]int{0, 1}, Offset: 5, Length: 1}, Result{Index: [2]int{0, 1}, Offset: 12, Length: 1}})
+	// BOF patterns whose anchor isn't at their start still match, but only at 0 offset
+	bof := []Seq{
+		Seq{MaxOffsets: []int64{0}, Choices: []Choice{nil}, Patterns: [][]Pattern{{pat("?? ?? 504b 0304")}}},
+		Seq{MaxOffsets: []int64{0}, Choices: []Choice{nil}, Patterns: [][]Pattern{{pat("?? 504b")}}},
+	}
+	test(t, []byte("xxPK\x03\x04"), bof, []Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 6}})
+	test(t, []byte("xPK\x03\x04"), bof, []Result{Result{Index: [2]int{1, 0}, Offset: 0, Length: 3}})
+	test(t, []byte("yxxPK\x03\x04"), bof, []Result{})
+}
+
+func TestExclusions(t *testing.T) {
+	zip := Seq{
+		MaxOffsets: []int64{-1, -1},
+		Choices:    []Choice{Choice{[]byte("PK\x03\x04")}, Choice{[]byte("app")}},
+		Exclusions: []Exclusion{Exclusion{After: 0, Window: 4, Choice: Choice{[]byte("mimetype")}}},
+	}
+	// the first header is vetoed, the second is held back until its window has passed, along with the Choice that follows it
+	test(t, []byte("PK\x03\x04abmimetype PK\x03\x04cdefghij app"),
+		[]Seq{zip, Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("ab")}}, Exclusions: []Exclusion{Exclusion{0, 0, Choice{[]byte("x")}}}}},
+		[]Result{Result{Index: [2]int{1, 0}, Offset: 4, Length: 2}, Result{Index: [2]int{0, 0}, Offset: 15, Length: 4}, Result{Index: [2]int{0, 1}, Offset: 28, Length: 3}})
+	// a vetoed match isn't a precondition for the Choices that follow it
+	test(t, []byte("PK\x03\x04mimetype app"), []Seq{zip}, []Result{})
+	// matches still held back at the end of the input are reported
+	test(t, []byte("PK\x03\x04app"), []Seq{zip}, []Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 4}, Result{Index: [2]int{0, 1}, Offset: 4, Length: 3}})
+}
+
+func TestUnordered(t *testing.T) {
+	riff := Seq{
+		MaxOffsets: []int64{-1, -1, -1, -1, -1},
+		Choices:    []Choice{Choice{[]byte("RIFF")}, Choice{[]byte("fmt")}, Choice{[]byte("LIST")}, Choice{[]byte("data")}, Choice{[]byte("end")}},
+		Unordered:  []Group{{1, 4}},
+	}
+	input := []byte("fmt RIFF LIST end data fmt end")
+	// members of the group only match after the Choice before it, and the Choice after it only once they all have
+	test(t, input, []Seq{riff},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 4, Length: 4}, Result{Index: [2]int{0, 2}, Offset: 9, Length: 4}, Result{Index: [2]int{0, 3}, Offset: 18, Length: 4}, Result{Index: [2]int{0, 1}, Offset: 23, Length: 3}, Result{Index: [2]int{0, 4}, Offset: 27, Length: 3}})
+	expect := []SeqMatch{SeqMatch{0, []int64{4, 23, 9, 18, 27}, []int{4, 3, 4, 4, 3}, []int{0, 2, 3, 1, 4}, []int{1, 1, 1, 1, 1}}}
+	var results []SeqMatch
+	for m := range NewVerified([]Seq{riff}).Index(bytes.NewBuffer(input)) {
+		results = append(results, m)
+	}
+	if fmt.Sprint(expect) != fmt.Sprint(results) {
+		t.Errorf("Verified fail; Expecting: %v, Got: %v", expect, results)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	// a header, optionally a BOM, then one to three record markers
+	rec := Seq{
+		MaxOffsets: []int64{-1, -1, -1, -1},
+		Choices:    []Choice{Choice{[]byte("HDR")}, Choice{[]byte("\xef\xbb\xbf")}, Choice{[]byte("REC")}, Choice{[]byte("END")}},
+		Counts:     []Count{{1, -1}, {0, 1}, {1, 3}},
+	}
+	input := []byte("HDR REC REC REC REC END")
+	// the BOM is skipped, and only three records are reported
+	test(t, input, []Seq{rec},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 4, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 8, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 12, Length: 3}, Result{Index: [2]int{0, 3}, Offset: 20, Length: 3}})
+	test(t, []byte("HDR\xef\xbb\xbfREC END"), []Seq{rec},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{0, 1}, Offset: 3, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 6, Length: 3}, Result{Index: [2]int{0, 3}, Offset: 10, Length: 3}})
+	expect := []SeqMatch{SeqMatch{0, []int64{0, -1, 4, 20}, []int{3, 0, 3, 3}, []int{0, 2, 3}, []int{1, 0, 3, 1}}}
+	var results []SeqMatch
+	for m := range NewVerified([]Seq{rec}).Index(bytes.NewBuffer(input)) {
+		results = append(results, m)
+	}
+	if fmt.Sprint(expect) != fmt.Sprint(results) {
+		t.Errorf("Verified fail; Expecting: %v, Got: %v", expect, results)
+	}
+	// the end only follows two records
+	rec.Counts[2] = Count{2, -1}
+	test(t, []byte("HDR REC END REC END"), []Seq{rec},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 4, Length: 3}, Result{Index: [2]int{0, 2}, Offset: 12, Length: 3}, Result{Index: [2]int{0, 3}, Offset: 16, Length: 3}})
+}
+
+func TestGaps(t *testing.T) {
+	ab := Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("A")}, Choice{[]byte("B")}}, Gaps: []Gap{{0, -1}, {4, 12}}}
+	// B is too near A, then within the gap, then too far
+	test(t, []byte("A--B------B---------------------B"), []Seq{ab},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 1}, Result{Index: [2]int{0, 1}, Offset: 10, Length: 1}})
+	// the gap is measured from the latest match of A
+	test(t, []byte("A------------------------------A----B"), []Seq{ab},
+		[]Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 1}, Result{Index: [2]int{0, 0}, Offset: 31, Length: 1}, Result{Index: [2]int{0, 1}, Offset: 36, Length: 1}})
+}
+
+func TestCandidates(t *testing.T) {
+	for _, c := range []struct {
+		input  string
+		seq    Seq
+		expect Result
+	}{
+		// neither the first nor the latest A is within the gap of B, but the one between them is
+		{"A-------A-----A-B", Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("A")}, Choice{[]byte("B")}}, Gaps: []Gap{{0, -1}, {4, 10}}},
+			Result{Index: [2]int{0, 1}, Offset: 16, Length: 1}},
+		// the match of aa that B immediately follows overlaps the first
+		{"aaaB", Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("aa")}, Choice{[]byte("B")}}, Gaps: []Gap{{0, -1}, {0, 0}}},
+			Result{Index: [2]int{0, 1}, Offset: 3, Length: 1}},
+	} {
+		w := New([]Seq{c.seq})
+		w.SetCandidates(0)
+		results := loop(w.Index(bytes.NewBufferString(c.input)))
+		if results[len(results)-1].Index[1] == 1 {
+			t.Errorf("Candidates fail; Expecting B to be missed without candidates, Got: %v", results)
+		}
+		w.SetCandidates(DefaultCandidates)
+		results = loop(w.Index(bytes.NewBufferString(c.input)))
+		if results[len(results)-1] != c.expect {
+			t.Errorf("Candidates fail; Expecting: %v, Got: %v", c.expect, results)
+		}
+		// the number can be changed while a scan runs (run with -race)
+		output := w.Index(bytes.NewBufferString(c.input))
+		w.SetCandidates(0)
+		if results = loop(output); len(results) == 0 || results[0].Index != [2]int{0, 0} {
+			t.Errorf("Candidates fail; Expecting the scan to run while candidates are set, Got: %v", results)
+		}
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	p, err := ParsePattern("4d5a ?? 30-39 !00 &0f=01 41,43,45")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Pattern{Byte('M'), Byte('Z'), Any(), Range('0', '9'), Byte(0).Not(), Mask(0x0f, 0x01), Byte('A').Union(Byte('C')).Union(Byte('E'))}
+	if !reflect.DeepEqual(expect, p) {
+		t.Errorf("Parse Pattern fail; Expecting: %v, Got: %v", expect, p)
+	}
+	if p.String() != "4d5a ?? 30-39 !00 &0f=01 41,43,45" {
+		t.Errorf("Pattern String fail; Got: %s", p)
+	}
+	for _, bad := range []string{"4d5", "zz", "30-", "&0f", "!"} {
+		if _, err := ParsePattern(bad); err == nil {
+			t.Errorf("Parse Pattern fail; Expecting an error for %q", bad)
+		}
+	}
+}
+
+func TestVerified(t *testing.T) {
+	v := NewVerified([]Seq{
+		Seq{MaxOffsets: []int64{0, 18, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}, Choice{[]byte("l")}}},
+		Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("The")}}},
+		Seq{MaxOffsets: []int64{8, -1}, Choices: []Choice{Choice{[]byte("had")}, Choice{[]byte("ndle"), []byte("le")}}},
+		Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("pot")}, Choice{[]byte("The")}}},
+	})
+	expect := []SeqMatch{
+		SeqMatch{1, []int64{0}, []int{3}, []int{0}, []int{1}},
+		SeqMatch{0, []int64{0, 4, 18}, []int{3, 3, 1}, []int{0, 1, 2}, []int{1, 1, 1}},
+		SeqMatch{2, []int64{8, 16}, []int{3, 4}, []int{0, 1}, []int{1, 1}},
+	}
+	var results []SeqMatch
+	for m := range v.Index(bytes.NewBuffer([]byte("The pot had a handle"))) {
+		results = append(results, m)
+	}
+	if fmt.Sprint(expect) != fmt.Sprint(results) {
+		t.Errorf("Verified fail; Expecting: %v, Got: %v", expect, results)
+	}
+	// a skipped Choice that matches after the Seq is reported doesn't change the match that was sent
+	// (run with -race: the match is read while the scan goes on)
+	opt := Seq{MaxOffsets: []int64{-1, -1, -1}, Choices: []Choice{Choice{[]byte("A")}, Choice{[]byte("bom")}, Choice{[]byte("B")}}, Counts: []Count{{1, -1}, {0, 1}, {1, -1}}}
+	output := NewVerified([]Seq{opt}).Index(bytes.NewBuffer([]byte("A B bom bom bom")))
+	m := <-output
+	got := fmt.Sprint(m)
+	for range output {
+	}
+	if want := "{0 [0 -1 2] [1 0 1] [0 2] [1 0 1]}"; got != want || fmt.Sprint(m) != want {
+		t.Errorf("Verified fail; Expecting: %v, Got: %v, then %v", want, got, m)
+	}
+}
+
+// readerAt records the lowest offset read
+type readerAt struct {
+	*bytes.Reader
+	lowest int64
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < r.lowest {
+		r.lowest = off
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestEOF(t *testing.T) {
+	input := []byte("The pot had a handle")
+	e := NewEOF([]Seq{
+		Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("dle")}}},
+		Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("handle")}, Choice{[]byte("pot"), []byte("The")}}},
+		Seq{MaxOffsets: []int64{-1, -1}, Choices: []Choice{Choice{[]byte("pot")}, Choice{[]byte("handle")}}},
+	})
+	expect := []Result{
+		Result{Index: [2]int{0, 0}, Offset: 0, Length: 3},
+		Result{Index: [2]int{1, 0}, Offset: 0, Length: 6},
+		Result{Index: [2]int{1, 1}, Offset: 13, Length: 3},
+		Result{Index: [2]int{2, 0}, Offset: 13, Length: 3},
+		Result{Index: [2]int{1, 1}, Offset: 17, Length: 3, Alt: 1},
+	}
+	results := loop(e.Index(bytes.NewReader(input), int64(len(input))))
+	if !equal(expect, results) {
+		t.Errorf("EOF fail; Expecting: %v, Got: %v", expect, results)
+	}
+	abs := []int64{17, 14, 4, 4, 0}
+	for i, res := range results {
+		if res.Abs(int64(len(input))) != abs[i] {
+			t.Errorf("EOF fail; Expecting absolute offset %d, Got: %d", abs[i], res.Abs(int64(len(input))))
+		}
+	}
+	// max offsets bound how far back the input is read
+	rdr := &readerAt{bytes.NewReader(input), int64(len(input))}
+	e = NewEOF([]Seq{Seq{MaxOffsets: []int64{2}, Choices: []Choice{Choice{[]byte("ndl"), []byte("ha")}}}})
+	results = loop(e.Index(rdr, int64(len(input))))
+	if !equal([]Result{Result{Index: [2]int{0, 0}, Offset: 1, Length: 3}}, results) {
+		t.Errorf("EOF fail; Expecting a single result, Got: %v", results)
+	}
+	if rdr.lowest != 15 {
+		t.Errorf("EOF fail; Expecting to read back to offset 15, Got: %d", rdr.lowest)
+	}
+}
+
 func TestProgess(t *testing.T) {
 	test(t, make([]byte, 32768),
 		[]Seq{
-			Seq{[]int64{-1}, []Choice{Choice{[]byte("The")}}},
+			Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte("The")}}},
 		},
 		[]Result{
-			Result{[2]int{-1, -1}, 1024, 0},
-			Result{[2]int{-1, -1}, 2048, 0},
-			Result{[2]int{-1, -1}, 4096, 0},
-			Result{[2]int{-1, -1}, 8192, 0},
-			Result{[2]int{-1, -1}, 16384, 0},
-			Result{[2]int{-1, -1}, 32768, 0},
+			Result{Index: [2]int{-1, -1}, Offset: 1024, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 2048, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 4096, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 8192, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 16384, Length: 0},
+			Result{Index: [2]int{-1, -1}, Offset: 32768, Length: 0},
 		})
 }
 
+func TestIndexProgress(t *testing.T) {
+	input := append(make([]byte, 3000), []byte("The")...)
+	seqs := []Seq{seq("The")}
+	expect := []Result{Result{Index: [2]int{0, 0}, Offset: 3000, Length: 3}}
+	for _, c := range []struct {
+		every   int64
+		reports []int64
+	}{
+		{0, []int64{1024, 2048}},
+		{1000, []int64{1000, 2000, 3000}},
+	} {
+		var reports []int64
+		results := loop(New(seqs).IndexProgress(bytes.NewBuffer(input), Progress{c.every, func(o int64) { reports = append(reports, o) }}))
+		if !equal(expect, results) {
+			t.Errorf("Index Progress fail; Expecting: %v, Got: %v", expect, results)
+		}
+		if fmt.Sprint(reports) != fmt.Sprint(c.reports) {
+			t.Errorf("Index Progress fail; Expecting reports: %v, Got: %v", c.reports, reports)
+		}
+	}
+	results := loop(New(seqs).IndexProgress(bytes.NewBuffer(input), Progress{}))
+	if !equal(expect, results) {
+		t.Errorf("Index Progress fail with progress off; Expecting: %v, Got: %v", expect, results)
+	}
+}
+
+func TestNewChecked(t *testing.T) {
+	good := Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("pot")}}}
+	if _, err := NewChecked([]Seq{good}); err != nil {
+		t.Errorf("New Checked fail; Expecting no error, Got: %v", err)
+	}
+	for _, c := range []struct {
+		seq    Seq
+		choice int
+	}{
+		{Seq{}, -1},
+		{Seq{MaxOffsets: []int64{0}, Choices: good.Choices}, -1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, MinOffsets: []int64{0, 0, 0}}, -1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("The")}, Choice{}}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("The"), []byte{}}, Choice{[]byte("pot")}}}, 0},
+		{Seq{MaxOffsets: []int64{0, -2}, Choices: good.Choices}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, MinOffsets: []int64{-1}}, 0},
+		{Seq{MaxOffsets: []int64{0, 8}, Choices: good.Choices, MinOffsets: []int64{0, 9}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Patterns: [][]Pattern{nil}}, -1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Patterns: [][]Pattern{nil, {Pattern{Any(), Any()}}}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Patterns: [][]Pattern{{Pattern{Byte('a'), Any().Not()}}, nil}}, 0},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Exclusions: []Exclusion{{After: 2, Choice: Choice{[]byte("x")}}}}, -1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Exclusions: []Exclusion{{After: 1, Window: -1, Choice: Choice{[]byte("x")}}}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Exclusions: []Exclusion{{After: 0}}}, 0},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Unordered: []Group{{1, 3}}}, -1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Counts: []Count{{1, 1}, {2, 1}}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Gaps: []Gap{{0, -1}, {8, 4}}}, 1},
+		{Seq{MaxOffsets: []int64{0, -1}, Choices: good.Choices, Counts: []Count{{1, 1}, {1, 1}, {1, 1}}}, -1},
+		{Seq{MaxOffsets: []int64{0, -1, -1}, Choices: append(good.Choices, good.Choices[1]), Unordered: []Group{{0, 2}, {1, 3}}}, -1},
+	} {
+		_, err := NewChecked([]Seq{good, c.seq})
+		e, ok := err.(*SeqError)
+		if !ok {
+			t.Errorf("New Checked fail; Expecting an error for %v, Got: %v", c.seq, err)
+			continue
+		}
+		if e.Seq != 1 || e.Choice != c.choice {
+			t.Errorf("New Checked fail; Expecting an error at seq 1, choice %d, Got: %v", c.choice, err)
+		}
+	}
+}
+
+func TestParseSeq(t *testing.T) {
+	for _, s := range []Seq{
+		Seq{MaxOffsets: []int64{5, -1}, Choices: []Choice{Choice{[]byte("b"), []byte("c"), []byte("d")}, Choice{[]byte("ad")}}},
+		Seq{MaxOffsets: []int64{-1}, Choices: []Choice{Choice{[]byte(" a|b], [c\\ ")}}, MinOffsets: []int64{16}},
+		Seq{MaxOffsets: []int64{0, 32}, Choices: []Choice{Choice{[]byte{0, 0xff, 'P', 'K', 3, 4}}, Choice{[]byte("x y"), []byte{'\n'}}}, MinOffsets: []int64{0, 16}},
+		Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{nil, Choice{[]byte("ad")}}, Patterns: [][]Pattern{{Pattern{Byte('M'), Any(), Range('0', '9')}}, nil}},
+		Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("PK")}, Choice{[]byte("ad")}}, Exclusions: []Exclusion{{0, 30, Choice{[]byte("mime")}}, {1, 0, Choice{[]byte("x"), []byte("y")}}}},
+		Seq{MaxOffsets: []int64{0, -1, -1}, Choices: []Choice{Choice{[]byte("a")}, Choice{[]byte("b")}, Choice{[]byte("c")}}, Unordered: []Group{{1, 3}}},
+		Seq{MaxOffsets: []int64{-1, -1, -1}, Choices: []Choice{Choice{[]byte("a")}, Choice{[]byte("b")}, Choice{[]byte("c")}}, Counts: []Count{{1, 1}, {0, -1}, {2, 5}}, Gaps: []Gap{{0, -1}, {4, 12}}},
+	} {
+		p, err := ParseSeq(s.String())
+		if err != nil {
+			t.Errorf("Parse Seq fail for %s: %v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(s, p) {
+			t.Errorf("Parse Seq fail; Expecting: %#v, Got: %#v", s, p)
+		}
+	}
+	p, err := ParseSeq("{ Offsets: 5,-1 ; Choices: [ \\x50K | b\\x7c ] , [ad] }")
+	expect := Seq{MaxOffsets: []int64{5, -1}, Choices: []Choice{Choice{[]byte("PK"), []byte("b|")}, Choice{[]byte("ad")}}}
+	if err != nil || !reflect.DeepEqual(expect, p) {
+		t.Errorf("Parse Seq fail; Expecting: %v, Got: %v, %v", expect, p, err)
+	}
+}
+
+func TestParseSeqErrors(t *testing.T) {
+	for _, c := range []struct {
+		str string
+		pos int
+	}{
+		{"Offsets: 5; Choices: [a]}", 0},
+		{"{Offsets: 5x; Choices: [a]}", 11},
+		{"{Offsets: 5; Choices: [a}", 25},
+		{"{Offsets: 5; Choices: [a\\x4g]}", 24},
+		{"{Offsets: 5; Choices: [a [b]]}", 25},
+		{"{Offsets: 5; Choices: [a]} extra", 27},
+		{"{Offsets: 5; MinOffsets: -; Choices: [a]}", 25},
+		{"{Offsets: 5, -1; Choices: [a], []; Patterns: [], [61 3x-39]}", 53},
+		{"{Offsets: 5; Choices: []; Patterns: [61 | 62 ?? 6]}", 48},
+	} {
+		_, err := ParseSeq(c.str)
+		e, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Parse Seq fail; Expecting an error for %q, Got: %v", c.str, err)
+			continue
+		}
+		if e.Pos != c.pos {
+			t.Errorf("Parse Seq fail; Expecting an error at %d for %q, Got: %v", c.pos, c.str, err)
+		}
+	}
+}
+
+// byteCounter records the number of bytes read
+type byteCounter struct {
+	*bytes.Buffer
+	n int
+}
+
+func (b *byteCounter) ReadByte() (byte, error) {
+	b.n++
+	return b.Buffer.ReadByte()
+}
+
+func TestIndexContext(t *testing.T) {
+	input := &byteCounter{Buffer: bytes.NewBuffer(bytes.Repeat([]byte("The pot had a handle "), 100000))}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	output := New([]Seq{seq("pot"), seq("had")}).IndexContext(ctx, input)
+	var results int
+	for range output {
+		results++
+		if results == 2 {
+			cancel()
+			break
+		}
+	}
+	for range output { // the channel is closed once the scan has stopped
+	}
+	if input.n > 1000 {
+		t.Errorf("Index Context fail; Expecting the scan to stop early, read %d bytes", input.n)
+	}
+}
+
+func TestIndexWith(t *testing.T) {
+	seqs := []Seq{
+		Seq{MaxOffsets: []int64{0, 8}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("had")}}},
+		seq("pot"),
+		Seq{MaxOffsets: []int64{4}, Choices: []Choice{Choice{[]byte("pot")}}},
+	}
+	expect := []Result{Result{Index: [2]int{0, 0}, Offset: 0, Length: 3}, Result{Index: [2]int{2, 0}, Offset: 4, Length: 3}, Result{Index: [2]int{0, 1}, Offset: 8, Length: 3}}
+	for _, w := range []*Wac{New(seqs), NewLowMem(seqs)} {
+		input := &byteCounter{Buffer: bytes.NewBuffer(bytes.Repeat([]byte("The pot had a handle "), 1000))}
+		if results := loop(w.IndexWith(input, NewSeqMask(0, 2))); !equal(expect, results) {
+			t.Errorf("Index With fail; Expecting: %v, Got: %v", expect, results)
+		}
+		if input.n > 11 {
+			t.Errorf("Index With fail; Expecting the scan to stop once the enabled Seqs are exhausted, read %d bytes", input.n)
+		}
+		input = &byteCounter{Buffer: bytes.NewBuffer([]byte("The pot had a handle"))}
+		if results := loop(w.IndexWith(input, SeqMask{})); len(results) > 0 || input.n > 0 {
+			t.Errorf("Index With fail; Expecting nothing to be read with an empty mask, got %v and read %d bytes", results, input.n)
+		}
+		// a nil mask enables every Seq
+		all := loop(w.Index(bytes.NewBuffer([]byte("The pot had a handle"))))
+		if results := loop(w.IndexWith(bytes.NewBuffer([]byte("The pot had a handle")), nil)); !equal(all, results) {
+			t.Errorf("Index With fail; Expecting a nil mask to match like Index: %v, Got: %v", all, results)
+		}
+		// the mask is copied, so changing it doesn't change a scan that has started
+		mask := NewSeqMask(1)
+		output := w.IndexWith(bytes.NewBuffer([]byte("The pot had a handle")), mask)
+		mask.Clear(1)
+		if results := loop(output); len(results) != 1 || results[0].Index[0] != 1 {
+			t.Errorf("Index With fail; Expecting the mask to be copied, Got: %v", results)
+		}
+	}
+}
+
+// final returns the final result of a scan
+func final(output chan Result) Result {
+	var last Result
+	for res := range output {
+		last = res
+	}
+	return last
+}
+
+func TestStop(t *testing.T) {
+	text := bytes.Repeat([]byte("The pot had a handle "), 1000)
+	bounded := []Seq{
+		Seq{MaxOffsets: []int64{0, 8}, Choices: []Choice{Choice{[]byte("The")}, Choice{[]byte("had")}}},
+		Seq{MaxOffsets: []int64{4}, Choices: []Choice{Choice{[]byte("pot")}}},
+	}
+	wild := append(bounded, seq("pot"))
+	for _, c := range []struct {
+		seqs  []Seq
+		input io.ByteReader
+		read  int64
+		stop  Stop
+	}{
+		{bounded, bytes.NewBuffer(text), 11, Exhausted},
+		{wild, bytes.NewBuffer(text), int64(len(text)), EndOfInput},
+		{wild, bufio.NewReader(io.MultiReader(bytes.NewReader(text[:50]), iotest.ErrReader(errors.New("bad read")))), 50, ReadError},
+	} {
+		expect := Result{Index: [2]int{-1, -1}, Offset: c.read, Stop: c.stop}
+		if res := final(New(c.seqs).IndexWith(c.input, nil)); res != expect {
+			t.Errorf("Stop fail; Expecting: %v, Got: %v", expect, res)
+		}
+	}
+	input := &byteCounter{Buffer: bytes.NewBuffer(text)}
+	if res := final(NewLowMem(bounded).IndexWith(input, nil)); res.Stop != Exhausted || input.n != 11 {
+		t.Errorf("Stop fail for Low Mem; Expecting the scan to be exhausted after 11 bytes, got %v after %d bytes", res.Stop, input.n)
+	}
+	// Index stops early too, but doesn't report why
+	input = &byteCounter{Buffer: bytes.NewBuffer(text)}
+	if res := final(New(bounded).Index(input)); res.Index[0] < 0 || input.n != 11 {
+		t.Errorf("Stop fail for Index; Expecting no final result, and the scan to stop after 11 bytes, got %v after %d bytes", res, input.n)
+	}
+}
+
+func TestRetire(t *testing.T) {
+	input := &byteCounter{Buffer: bytes.NewBuffer(bytes.Repeat([]byte("The pot had a handle "), 1000))}
+	h := New([]Seq{seq("pot"), seq("had"), seq("handle")}).IndexScan(input, NewSeqMask(0, 1))
+	hits := make([]int, 3)
+	var last Result
+	for res := range h.Results {
+		last = res
+		if res.Index[0] < 0 {
+			continue
+		}
+		hits[res.Index[0]]++
+		h.Retire(res.Index[0])
+	}
+	// a result already on its way when a Seq is retired may still be received
+	if hits[0] < 1 || hits[0] > 2 || hits[1] < 1 || hits[1] > 2 || hits[2] > 0 {
+		t.Errorf("Retire fail; Expecting a result or two for each enabled Seq, got %v", hits)
+	}
+	if last.Stop != Retired || input.n > 100 {
+		t.Errorf("Retire fail; Expecting the scan to stop once every Seq is retired, got %v after %d bytes", last.Stop, input.n)
+	}
+	// an empty mask enables nothing
+	input = &byteCounter{Buffer: bytes.NewBuffer([]byte("The pot had a handle"))}
+	if res := final(New([]Seq{seq("pot")}).IndexScan(input, SeqMask{}).Results); res.Stop != Exhausted || input.n > 0 {
+		t.Errorf("Retire fail; Expecting nothing to be read with an empty mask, got %v after %d bytes", res.Stop, input.n)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s := Seq{MaxOffsets: []int64{0, -1}, Choices: []Choice{Choice{[]byte("PK"), []byte{'P', 'K', 3, 4}, []byte("hex:")}, Choice{[]byte("mime type|")}}, MinOffsets: []int64{0, 16}}
+	byts, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"maxOffsets":[0,-1],"minOffsets":[0,16],"choices":[["PK","hex:504b0304","hex:6865783a"],["mime type|"]]}`
+	if string(byts) != expect {
+		t.Errorf("Marshal fail; Expecting: %s, Got: %s", expect, byts)
+	}
+	var j Seq
+	if err := json.Unmarshal(byts, &j); err != nil || !reflect.DeepEqual(s, j) {
+		t.Errorf("Unmarshal JSON fail; Expecting: %v, Got: %v, %v", s, j, err)
+	}
+	byts, err = s.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txt Seq
+	if err := txt.UnmarshalText(byts); err != nil || !reflect.DeepEqual(s, txt) {
+		t.Errorf("Unmarshal Text fail; Expecting: %v, Got: %v, %v", s, txt, err)
+	}
+	s = Seq{MaxOffsets: []int64{-1}, Choices: []Choice{nil}, Patterns: [][]Pattern{{Pattern{Byte('M'), Any(), Range('0', '9')}}}}
+	byts, err = json.Marshal(s)
+	if expect = `{"maxOffsets":[-1],"choices":[[]],"patterns":[["4d ?? 30-39"]]}`; err != nil || string(byts) != expect {
+		t.Errorf("Marshal fail; Expecting: %s, Got: %s, %v", expect, byts, err)
+	}
+	j = Seq{}
+	if err := json.Unmarshal(byts, &j); err != nil || !reflect.DeepEqual(s.Patterns, j.Patterns) {
+		t.Errorf("Unmarshal JSON fail; Expecting: %v, Got: %v, %v", s, j, err)
+	}
+	s = Seq{MaxOffsets: []int64{0}, Choices: []Choice{Choice{[]byte("PK")}}, Exclusions: []Exclusion{{0, 30, Choice{[]byte("mimetype")}}}}
+	byts, err = json.Marshal(s)
+	if expect = `{"maxOffsets":[0],"choices":[["PK"]],"exclusions":[{"after":0,"window":30,"choice":["mimetype"]}]}`; err != nil || string(byts) != expect {
+		t.Errorf("Marshal fail; Expecting: %s, Got: %s, %v", expect, byts, err)
+	}
+	j = Seq{}
+	if err := json.Unmarshal(byts, &j); err != nil || !reflect.DeepEqual(s, j) {
+		t.Errorf("Unmarshal JSON fail; Expecting: %v, Got: %v, %v", s, j, err)
+	}
+	var c Choice
+	if err := c.UnmarshalText([]byte("[a | \\x00]")); err != nil || !reflect.DeepEqual(c, Choice{[]byte("a"), []byte{0}}) {
+		t.Errorf("Unmarshal Text fail for a Choice; Got: %v, %v", c, err)
+	}
+	if err := json.Unmarshal([]byte(`["hex:zz"]`), &c); err == nil {
+		t.Error("Unmarshal JSON fail; Expecting an error for invalid hex")
+	}
+}
+
 // Benchmarks
 func BenchmarkNew(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -273,3 +856,83 @@ func BenchmarkProgress(b *testing.B) {
 		}
 	}
 }
+
+// signatures returns a large set of Seqs, with a mix of anchored and wildcard Choices, like a set of file format signatures
+func signatures(n int) []Seq {
+	r := rand.New(rand.NewSource(1))
+	rnd := func(l int) []byte {
+		b := make([]byte, l)
+		r.Read(b)
+		return b
+	}
+	seqs := make([]Seq, n)
+	for i := range seqs {
+		seqs[i] = Seq{
+			MaxOffsets: []int64{int64(r.Intn(3)) * 8, -1},
+			Choices:    []Choice{Choice{rnd(2 + r.Intn(6))}, Choice{rnd(3 + r.Intn(6)), rnd(3 + r.Intn(6))}},
+		}
+	}
+	return seqs
+}
+
+var constructors = []struct {
+	name string
+	fn   func([]Seq) *Wac
+}{
+	{"New", New},
+	{"NewLowMem", NewLowMem},
+	{"NewAdaptive", NewAdaptive},
+	{"NewFlat", NewFlat},
+}
+
+// BenchmarkTrees compares the speed of the trees, and reports the heap size of each as heap-bytes
+func BenchmarkTrees(b *testing.B) {
+	seqs := signatures(5000)
+	input := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(input)
+	for _, c := range constructors {
+		b.Run(c.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			ac := c.fn(seqs)
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.SetBytes(int64(len(input)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _ = range ac.Index(bytes.NewReader(input)) {
+				}
+			}
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc), "heap-bytes")
+			runtime.KeepAlive(ac)
+		})
+	}
+}
+
+func BenchmarkTreesNew(b *testing.B) {
+	seqs := signatures(5000)
+	for _, c := range constructors {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = c.fn(seqs)
+			}
+		})
+	}
+}
+
+// BenchmarkTreesGC measures a garbage collection while each tree is live: flat trees don't need to be traced
+func BenchmarkTreesGC(b *testing.B) {
+	seqs := signatures(5000)
+	for _, c := range constructors {
+		b.Run(c.name, func(b *testing.B) {
+			ac := c.fn(seqs)
+			runtime.GC()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			runtime.KeepAlive(ac)
+		})
+	}
+}